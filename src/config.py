@@ -1,2 +1,36 @@
 API_TOKEN_KEY = ''
 ADMINS = []
+VIEWERS = []
+ADMINS_FILE = ''
+READ_ONLY = False
+MOUNT_DEVICES = []
+MOUNT_POINTS = []
+API_ENDPOINT = ''
+LOG_FILE = ''
+START_STATUS = True
+EXEC_USER = ''
+EXEC_DIR = ''
+EXEC_WRAPPER = []
+POWER_COMMANDS = False
+UNAUTHORIZED_MESSAGE = 'You don\'t have access to run this command'
+SILENT_UNAUTHORIZED = False
+ALERT_ON_LOGIN = False
+COMMAND_TIMEOUTS = {'default': 30}
+PERSISTENT_KEYBOARD = False
+REDACT_VALUES = []
+ALLOW_RESTART = False
+COMMAND_COOLDOWNS = {'benchmark': 60, 'dashboard': 5, 'processes': 5}
+ALERT_ON_BLOCKED = False
+EXTRA_BOTS = []
+DUPLICATE_WINDOW = 2
+MONITORED_MOUNTS = ['/']
+WEBHOOK_URL = ''
+WEBHOOK_LISTEN = '127.0.0.1'
+WEBHOOK_PORT = 8443
+TAIL_DURATION = 600
+KILL_GRACE_PERIOD = 5
+METRICS_HOST = '127.0.0.1'
+METRICS_PORT = 0
+AUDIT_FILE = ''
+ALLOWED_COMMANDS = []
+FD_ALERT_PERCENT = 0
@@ -0,0 +1,49 @@
+import os
+import re
+import subprocess
+from collections import Counter
+
+from . import files, shell
+
+AUTH_LOG = '/var/log/auth.log'
+ACCEPTED = re.compile(r'Accepted \S+ for (?P<user>\S+) from (?P<ip>\S+)')
+FAILED = re.compile(r'Failed \S+ for (?:invalid user )?(?P<user>\S+) from (?P<ip>\S+)')
+
+
+def auth_lines(count, timeout):
+    if os.access(AUTH_LOG, os.R_OK):
+        return files.tail(AUTH_LOG, count).splitlines()
+
+    exit_code, output = shell.run_args(
+        ['journalctl', '_COMM=sshd', '--no-pager', '-o', 'short', '-n', str(count)],
+        timeout=timeout
+    )
+    if exit_code != 0:
+        raise OSError(output.strip())
+    return output.splitlines()
+
+
+def login_events(count, timeout):
+    events, failures = [], Counter()
+    for line in auth_lines(count, timeout):
+        accepted, failed = ACCEPTED.search(line), FAILED.search(line)
+        if accepted:
+            events.append(f'✅ {line[:15]} {accepted["user"]} from {accepted["ip"]}')
+        elif failed:
+            events.append(f'❌ {line[:15]} {failed["user"]} from {failed["ip"]}')
+            failures[failed['ip']] += 1
+    return events, failures
+
+
+def follow_command():
+    if os.access(AUTH_LOG, os.R_OK):
+        return ['tail', '-n', '0', '-F', AUTH_LOG]
+    return ['journalctl', '_COMM=sshd', '--no-pager', '-o', 'short', '-n', '0', '-f']
+
+
+def watch_logins(on_login):
+    follower = subprocess.Popen(follow_command(), stdout=subprocess.PIPE, stderr=subprocess.DEVNULL)
+    for line in follower.stdout:
+        accepted = ACCEPTED.search(line.decode(errors='replace'))
+        if accepted:
+            on_login(accepted['user'], accepted['ip'])
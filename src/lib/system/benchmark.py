@@ -0,0 +1,40 @@
+import hashlib
+import os
+import tempfile
+import time
+
+CPU_DURATION = 1.0
+DISK_SIZE = 64 * 1024 ** 2
+DISK_BLOCK = 1024 ** 2
+
+
+def cpu_hashes_per_second():
+    block = os.urandom(1024)
+    deadline = time.perf_counter() + CPU_DURATION
+    count = 0
+    while time.perf_counter() < deadline:
+        hashlib.sha256(block).digest()
+        count += 1
+    return count / CPU_DURATION
+
+
+def disk_throughput(directory):
+    block = os.urandom(DISK_BLOCK)
+    with tempfile.NamedTemporaryFile(dir=directory) as benchmark_file:
+        start = time.perf_counter()
+        for _ in range(DISK_SIZE // DISK_BLOCK):
+            benchmark_file.write(block)
+        benchmark_file.flush()
+        os.fsync(benchmark_file.fileno())
+        write_seconds = time.perf_counter() - start
+
+        # Reads are likely served from the page cache, which is why the
+        # result is reported as a rough indicator only.
+        benchmark_file.seek(0)
+        start = time.perf_counter()
+        while benchmark_file.read(DISK_BLOCK):
+            pass
+        read_seconds = time.perf_counter() - start
+
+    megabytes = DISK_SIZE / 1024 ** 2
+    return megabytes / write_seconds, megabytes / read_seconds
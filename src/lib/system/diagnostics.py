@@ -0,0 +1,36 @@
+import os
+import platform
+import shutil
+
+from . import resources
+
+
+def init_system():
+    if os.path.isdir('/run/systemd/system'):
+        return 'systemd'
+    if shutil.which('rc-status'):
+        return 'openrc'
+    return 'unknown'
+
+
+def log_sources():
+    sources = ['journald'] if shutil.which('journalctl') else []
+    sources.extend(
+        path for path in ('/var/log/syslog', '/var/log/messages', '/var/log/auth.log')
+        if os.access(path, os.R_OK)
+    )
+    return sources
+
+
+def collect():
+    return {
+        'platform': platform.platform(),
+        'python': platform.python_version(),
+        'cpus': os.cpu_count(),
+        'memory': resources.format_bytes(resources.meminfo()['MemTotal']),
+        'init_system': init_system(),
+        'log_sources': ','.join(log_sources()) or 'none',
+        'sudo': 'yes' if shutil.which('sudo') else 'no',
+        'working_dir': os.getcwd(),
+        'working_dir_writable': 'yes' if os.access(os.getcwd(), os.W_OK) else 'no'
+    }
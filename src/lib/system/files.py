@@ -0,0 +1,99 @@
+import gzip
+import os
+import shutil
+import stat
+import tempfile
+from collections import deque
+
+
+def tail(path, lines):
+    with open(path, errors='replace') as tail_file:
+        return ''.join(deque(tail_file, maxlen=lines))
+
+
+class TailFollower:
+    def __init__(self, path):
+        self.path = path
+        self.offset = os.path.getsize(path)
+
+    def read_new(self):
+        size = os.path.getsize(self.path)
+        if size < self.offset:
+            # The file was truncated or rotated in place, start over from its beginning.
+            self.offset = 0
+        with open(self.path, 'rb') as follow_file:
+            follow_file.seek(self.offset)
+            data = follow_file.read()
+        self.offset += len(data)
+        return data.decode(errors='replace')
+
+
+def touch(path):
+    with open(path, 'a'):
+        os.utime(path)
+
+
+def append_line(path, text):
+    # A single write on an O_APPEND descriptor lands as one unit, so
+    # concurrent appends never interleave inside a line.
+    descriptor = os.open(path, os.O_WRONLY | os.O_APPEND | os.O_CREAT, 0o644)
+    try:
+        os.write(descriptor, f'{text}\n'.encode())
+    finally:
+        os.close(descriptor)
+
+
+def write_atomically(source, destination, write):
+    # A failed conversion must not leave a partial destination, or truncate it when it is the source.
+    descriptor, temporary = tempfile.mkstemp(dir=os.path.dirname(destination), prefix='.radmin-')
+    try:
+        with os.fdopen(descriptor, 'wb') as destination_file:
+            write(destination_file)
+        os.chmod(temporary, stat.S_IMODE(os.stat(source).st_mode))
+        os.replace(temporary, destination)
+    except BaseException:
+        try:
+            os.unlink(temporary)
+        except OSError:
+            pass
+        raise
+
+
+def compress(source, destination):
+    def write(destination_file):
+        with open(source, 'rb') as source_file, gzip.open(destination_file, 'wb') as compressed_file:
+            shutil.copyfileobj(source_file, compressed_file)
+    write_atomically(source, destination, write)
+
+
+def decompress(source, destination, max_size=None):
+    def write(destination_file):
+        written = 0
+        with gzip.open(source, 'rb') as source_file:
+            for chunk in iter(lambda: source_file.read(1024 * 1024), b''):
+                written += len(chunk)
+                if max_size is not None and written > max_size:
+                    raise ValueError(f'decompressed data is larger than {max_size} bytes')
+                destination_file.write(chunk)
+    write_atomically(source, destination, write)
+
+
+def allocated_size(path):
+    return os.lstat(path).st_blocks * 512
+
+
+def total_size(path, max_entries):
+    if not os.path.isdir(path) or os.path.islink(path):
+        return allocated_size(path), True
+
+    size, entries = 0, 0
+    for root, directories, names in os.walk(path):
+        for name in names + directories:
+            entries += 1
+            if entries > max_entries:
+                return size, False
+            try:
+                size += allocated_size(os.path.join(root, name))
+            except OSError:
+                pass
+    return size, True
@@ -0,0 +1,44 @@
+import itertools
+import threading
+import time
+
+
+class Job:
+    def __init__(self, job_id, owner, kind, description, cancel):
+        self.id = job_id
+        self.owner = owner
+        self.kind = kind
+        self.description = description
+        self.cancel = cancel
+        self.started = time.time()
+
+
+class JobRegistry:
+    def __init__(self):
+        self._jobs = {}
+        self._ids = itertools.count(1)
+        self._lock = threading.Lock()
+
+    def add(self, owner, kind, description, cancel):
+        with self._lock:
+            job = Job(next(self._ids), owner, kind, description, cancel)
+            self._jobs[job.id] = job
+            return job
+
+    def remove(self, job_id):
+        with self._lock:
+            return self._jobs.pop(job_id, None)
+
+    def list(self, owner):
+        with self._lock:
+            owned = [job for job in self._jobs.values() if job.owner == owner]
+        return sorted(owned, key=lambda job: job.id)
+
+    def cancel(self, job_id, owner):
+        with self._lock:
+            job = self._jobs.get(job_id)
+            if job is None or job.owner != owner:
+                return None
+            del self._jobs[job_id]
+        job.cancel()
+        return job
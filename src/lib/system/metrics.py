@@ -0,0 +1,46 @@
+import os
+import threading
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+
+from . import resources
+
+
+def exposition(mountpoints=('/',)):
+    lines = [
+        '# TYPE radmin_cpu_usage_percent gauge',
+        f'radmin_cpu_usage_percent {resources.cpu_percent():.2f}',
+        '# TYPE radmin_memory_usage_percent gauge',
+        f'radmin_memory_usage_percent {resources.memory_percent():.2f}',
+        '# TYPE radmin_disk_usage_percent gauge'
+    ]
+    lines.extend(
+        f'radmin_disk_usage_percent{{mountpoint="{mountpoint}"}} {resources.disk_percent(mountpoint):.2f}'
+        for mountpoint, _ in resources.mounted_disks(mountpoints)
+    )
+    lines.append('# TYPE radmin_load_average gauge')
+    lines.extend(
+        f'radmin_load_average{{period="{period}"}} {load:.2f}'
+        for period, load in zip(('1m', '5m', '15m'), os.getloadavg())
+    )
+    return '\n'.join(lines) + '\n'
+
+
+def serve(host, port, mountpoints):
+    class MetricsHandler(BaseHTTPRequestHandler):
+        def do_GET(self):
+            if self.path != '/metrics':
+                self.send_error(404)
+                return
+            body = exposition(mountpoints).encode()
+            self.send_response(200)
+            self.send_header('Content-Type', 'text/plain; version=0.0.4')
+            self.send_header('Content-Length', str(len(body)))
+            self.end_headers()
+            self.wfile.write(body)
+
+        def log_message(self, *args):
+            pass
+
+    server = ThreadingHTTPServer((host, port), MetricsHandler)
+    threading.Thread(target=server.serve_forever, daemon=True).start()
+    return server
@@ -0,0 +1,44 @@
+import os
+
+PSEUDO_FILESYSTEMS = {'tmpfs', 'devtmpfs', 'squashfs', 'overlay', 'ramfs'}
+
+
+def mount_table():
+    with open('/proc/mounts') as mounts_file:
+        # Whitespace inside paths is octal-escaped, e.g. a space is \040.
+        return [[field.replace('\\040', ' ') for field in line.split()] for line in mounts_file]
+
+
+def mount_state(target):
+    for device, mountpoint, fstype, *_ in mount_table():
+        if target in (device, mountpoint):
+            return f'{device} on {mountpoint} type {fstype}'
+    return f'{target} is not mounted'
+
+
+def disk_usage(include_pseudo=False):
+    usage, seen = [], set()
+    for device, mountpoint, fstype, *_ in mount_table():
+        if mountpoint in seen or (fstype in PSEUDO_FILESYSTEMS and not include_pseudo):
+            continue
+        try:
+            stats = os.statvfs(mountpoint)
+        except OSError:
+            continue
+        if stats.f_blocks == 0:
+            continue
+
+        seen.add(mountpoint)
+        total = stats.f_blocks * stats.f_frsize
+        free = stats.f_bavail * stats.f_frsize
+        used = total - stats.f_bfree * stats.f_frsize
+        usage.append({
+            'device': device,
+            'mountpoint': mountpoint,
+            'fstype': fstype,
+            'total': total,
+            'used': used,
+            'free': free,
+            'percent': 100 * used / (used + free) if used + free else 0.0
+        })
+    return usage
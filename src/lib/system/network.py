@@ -0,0 +1,103 @@
+import ipaddress
+import os
+import re
+import socket
+
+from . import shell
+
+HOSTNAME_LABEL = re.compile(r'^[A-Za-z0-9_]([A-Za-z0-9_-]{0,61}[A-Za-z0-9])?$')
+RECORD_FAMILIES = {'A': socket.AF_INET, 'AAAA': socket.AF_INET6}
+# Socket states from include/net/tcp_states.h: TCP_LISTEN, and TCP_CLOSE for an unconnected UDP socket.
+LISTENING_STATES = {'tcp': '0A', 'udp': '07'}
+
+
+def interface_addresses():
+    exit_code, output = shell.run_args(['ip', '-o', 'addr', 'show'])
+    if exit_code != 0:
+        raise OSError(output.strip())
+
+    interfaces = {}
+    for line in output.splitlines():
+        fields = line.split()
+        name, family, address = fields[1], fields[2], ipaddress.ip_interface(fields[3])
+        interfaces.setdefault(name, []).append({
+            'family': 'IPv4' if family == 'inet' else 'IPv6',
+            'address': address.with_prefixlen,
+            'link_local': address.ip.is_link_local
+        })
+    return interfaces
+
+
+def valid_hostname(name):
+    # Checked label by label, a single regex over the whole name backtracks exponentially.
+    if not 0 < len(name) <= 253:
+        return False
+    return all(HOSTNAME_LABEL.match(label) for label in name.rstrip('.').split('.'))
+
+
+def resolve(hostname, record_type):
+    if record_type == 'CNAME':
+        canonical, _, _ = socket.gethostbyname_ex(hostname)
+        return [canonical] if canonical != hostname.rstrip('.') else []
+
+    addresses = socket.getaddrinfo(hostname, None, RECORD_FAMILIES[record_type], socket.SOCK_STREAM)
+    return sorted({address[4][0] for address in addresses})
+
+
+def nameservers():
+    try:
+        with open('/etc/resolv.conf') as resolv_file:
+            return [line.split()[1] for line in resolv_file if line.startswith('nameserver')]
+    except OSError:
+        return []
+
+
+def socket_owners():
+    owners = {}
+    for pid in filter(str.isdigit, os.listdir('/proc')):
+        try:
+            with open(f'/proc/{pid}/comm') as comm_file:
+                name = comm_file.read().strip()
+            descriptors = os.listdir(f'/proc/{pid}/fd')
+        except OSError:
+            continue
+        for descriptor in descriptors:
+            try:
+                target = os.readlink(f'/proc/{pid}/fd/{descriptor}')
+            except OSError:
+                continue
+            if target.startswith('socket:['):
+                owners[target[8:-1]] = (int(pid), name)
+    return owners
+
+
+def decode_address(encoded):
+    address, port = encoded.split(':')
+    # Each 32-bit word of the address is stored in host byte order.
+    packed = b''.join(bytes.fromhex(address[i:i + 8])[::-1] for i in range(0, len(address), 8))
+    return ipaddress.ip_address(packed), int(port, 16)
+
+
+def listening_ports(protocols=('tcp', 'udp')):
+    owners = socket_owners()
+    ports = []
+    for protocol in protocols:
+        for suffix in ('', '6'):
+            try:
+                with open(f'/proc/net/{protocol}{suffix}') as table_file:
+                    rows = [line.split() for line in table_file.readlines()[1:]]
+            except OSError:
+                continue
+            for row in rows:
+                if row[3] != LISTENING_STATES[protocol]:
+                    continue
+                address, port = decode_address(row[1])
+                pid, name = owners.get(row[9], (None, '?'))
+                ports.append({
+                    'protocol': protocol + suffix,
+                    'address': f'[{address}]:{port}' if address.version == 6 else f'{address}:{port}',
+                    'port': port,
+                    'pid': pid,
+                    'name': name
+                })
+    return sorted(ports, key=lambda entry: (entry['port'], entry['protocol']))
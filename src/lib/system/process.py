@@ -0,0 +1,160 @@
+import os
+import pwd
+import signal
+import time
+
+from . import resources
+
+
+def read_stat(pid):
+    with open(f'/proc/{pid}/stat') as stat_file:
+        stat = stat_file.read()
+    # The process name may contain spaces and parentheses, so the
+    # remaining fields are read after the last closing parenthesis.
+    name = stat[stat.find('(') + 1:stat.rfind(')')]
+    return name, stat[stat.rfind(')') + 2:].split()
+
+
+def cpu_ticks():
+    ticks = {}
+    for entry in os.listdir('/proc'):
+        if not entry.isdigit():
+            continue
+        try:
+            name, fields = read_stat(entry)
+        except OSError:
+            continue
+        ticks[int(entry)] = (name, int(fields[11]) + int(fields[12]), int(fields[21]))
+    return ticks
+
+
+def top_processes(sort='cpu', limit=10, interval=0.5):
+    before = cpu_ticks()
+    time.sleep(interval)
+    after = cpu_ticks()
+
+    page_size = os.sysconf('SC_PAGE_SIZE')
+    memory_total = resources.meminfo()['MemTotal']
+    elapsed = interval * os.sysconf('SC_CLK_TCK')
+    processes = []
+    for pid, (name, ticks, rss_pages) in after.items():
+        previous = before.get(pid)
+        cpu = (ticks - previous[1]) / elapsed * 100 if previous else 0.0
+        processes.append({
+            'pid': pid,
+            'name': name,
+            'cpu': cpu,
+            'mem': rss_pages * page_size / memory_total * 100
+        })
+
+    processes.sort(key=lambda info: info[sort], reverse=True)
+    return processes[:limit]
+
+
+def boot_time():
+    with open('/proc/stat') as stat_file:
+        for line in stat_file:
+            if line.startswith('btime'):
+                return int(line.split()[1])
+    return 0
+
+
+def details(pid, interval=0.5):
+    _, before = read_stat(pid)
+    time.sleep(interval)
+    name, fields = read_stat(pid)
+
+    clock_ticks = os.sysconf('SC_CLK_TCK')
+    cpu_ticks = int(fields[11]) + int(fields[12]) - int(before[11]) - int(before[12])
+    with open(f'/proc/{pid}/cmdline', 'rb') as cmdline_file:
+        cmdline = cmdline_file.read().replace(b'\0', b' ').decode(errors='replace').strip()
+    with open(f'/proc/{pid}/status') as status_file:
+        uid = next(int(line.split()[1]) for line in status_file if line.startswith('Uid:'))
+    try:
+        user = pwd.getpwuid(uid).pw_name
+    except KeyError:
+        user = str(uid)
+    try:
+        open_files = len(os.listdir(f'/proc/{pid}/fd'))
+    except PermissionError:
+        open_files = None
+
+    return {
+        'pid': pid,
+        'name': name,
+        'cmdline': cmdline or f'[{name}]',
+        'status': fields[0],
+        'ppid': int(fields[1]),
+        'user': user,
+        'cpu': cpu_ticks / (interval * clock_ticks) * 100,
+        'rss': int(fields[21]) * os.sysconf('SC_PAGE_SIZE'),
+        'vms': int(fields[20]),
+        'threads': int(fields[17]),
+        'open_files': open_files,
+        'started': boot_time() + int(fields[19]) / clock_ticks
+    }
+
+
+def parent_map():
+    parents = {}
+    for entry in os.listdir('/proc'):
+        if not entry.isdigit():
+            continue
+        try:
+            _, fields = read_stat(entry)
+        except OSError:
+            continue
+        parents[int(entry)] = int(fields[1])
+    return parents
+
+
+def process_tree(pid):
+    parents = parent_map()
+    tree = [pid]
+    for current in tree:
+        tree.extend(child for child, parent in parents.items() if parent == current)
+    return tree
+
+
+def is_running(pid):
+    try:
+        os.kill(pid, 0)
+    except ProcessLookupError:
+        return False
+    except PermissionError:
+        return True
+    return True
+
+
+def signal_group(pid, sig):
+    try:
+        os.killpg(pid, sig)
+    except ProcessLookupError:
+        pass
+
+
+def terminate(pids, grace_period=5, force=False):
+    first_signal = signal.SIGKILL if force else signal.SIGTERM
+    signaled = {}
+    for pid in pids:
+        try:
+            os.kill(pid, first_signal)
+            signaled[pid] = first_signal.name
+        except ProcessLookupError:
+            pass
+        except PermissionError:
+            signaled[pid] = 'permission denied'
+
+    deadline = time.time() + grace_period
+    pending = [pid for pid, result in signaled.items() if result == 'SIGTERM']
+    while pending and time.time() < deadline:
+        time.sleep(0.2)
+        pending = [pid for pid in pending if is_running(pid)]
+
+    for pid in pending:
+        try:
+            os.kill(pid, signal.SIGKILL)
+            signaled[pid] = 'SIGKILL'
+        except ProcessLookupError:
+            pass
+    return signaled
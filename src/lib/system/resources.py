@@ -0,0 +1,101 @@
+import shutil
+import time
+
+
+def cpu_times():
+    with open('/proc/stat') as stat_file:
+        values = [int(value) for value in stat_file.readline().split()[1:]]
+    idle = values[3] + values[4]
+    return idle, sum(values)
+
+
+def cpu_percent(interval=0.2):
+    idle_before, total_before = cpu_times()
+    time.sleep(interval)
+    idle_after, total_after = cpu_times()
+    total = total_after - total_before
+    return 100 * (1 - (idle_after - idle_before) / total) if total else 0.0
+
+
+def meminfo():
+    info = {}
+    with open('/proc/meminfo') as meminfo_file:
+        for line in meminfo_file:
+            name, value = line.split(':', 1)
+            info[name] = int(value.split()[0]) * 1024
+    return info
+
+
+def memory_percent():
+    info = meminfo()
+    return 100 * (1 - info['MemAvailable'] / info['MemTotal'])
+
+
+def disk_percent(path='/'):
+    usage = shutil.disk_usage(path)
+    # Matches df: space reserved for root counts as neither used nor free.
+    return 100 * usage.used / (usage.used + usage.free)
+
+
+def open_files():
+    with open('/proc/sys/fs/file-nr') as file_nr:
+        allocated, _, maximum = (int(value) for value in file_nr.read().split())
+    return allocated, maximum
+
+
+def uptime():
+    with open('/proc/uptime') as uptime_file:
+        seconds = int(float(uptime_file.read().split()[0]))
+    days, seconds = divmod(seconds, 86400)
+    hours, seconds = divmod(seconds, 3600)
+    return f'{days}d {hours}h {seconds // 60}m'
+
+
+def format_bytes(size):
+    for unit in ('B', 'KB', 'MB', 'GB', 'TB'):
+        if size < 1024 or unit == 'TB':
+            return f'{size:.1f} {unit}'
+        size /= 1024
+
+
+def mounted_disks(mountpoints):
+    disks = []
+    for mountpoint in mountpoints:
+        try:
+            disks.append((mountpoint, shutil.disk_usage(mountpoint)))
+        except OSError:
+            continue
+    return disks
+
+
+def usage_report(mountpoints=('/',)):
+    info = meminfo()
+    memory_used = info['MemTotal'] - info['MemAvailable']
+    lines = [f'Memory: {format_bytes(memory_used)} / {format_bytes(info["MemTotal"])}']
+    lines.extend(
+        f'Disk {mountpoint}: {format_bytes(disk.used)} / {format_bytes(disk.total)}'
+        for mountpoint, disk in mounted_disks(mountpoints)
+    )
+    return '\n'.join(lines)
+
+
+def bar(percent, width=10):
+    filled = round(min(max(percent, 0), 100) / 100 * width)
+    return '█' * filled + '░' * (width - filled)
+
+
+def status_icon(percent):
+    if percent < 70:
+        return '🟢'
+    if percent < 90:
+        return '🟡'
+    return '🔴'
+
+
+def summary(mountpoints=('/',)):
+    metrics = [
+        ('CPU', cpu_percent()),
+        ('Mem', memory_percent())
+    ]
+    metrics.extend((f'Disk {mountpoint}', disk_percent(mountpoint)) for mountpoint, _ in mounted_disks(mountpoints))
+    return ' '.join(f'{status_icon(value)} {name} {value:.0f}%' for name, value in metrics)
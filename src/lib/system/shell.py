@@ -0,0 +1,82 @@
+import os
+import pwd
+import shutil
+import signal
+import subprocess
+
+DRAIN_TIMEOUT = 2
+
+
+def credentials(username):
+    if not username:
+        return {}
+
+    try:
+        user = pwd.getpwnam(username)
+    except KeyError:
+        raise ValueError(f'Unknown exec user: {username}')
+    if os.geteuid() == user.pw_uid:
+        # Already that user; switching groups would need CAP_SETGID, which a non-root bot lacks.
+        return {}
+    if os.geteuid() != 0:
+        raise ValueError(f'Running commands as {username} requires the bot to run as root')
+
+    return {
+        'user': user.pw_uid,
+        'group': user.pw_gid,
+        'extra_groups': os.getgrouplist(username, user.pw_gid)
+    }
+
+
+def validate_sandbox(directory, wrapper, credentials=None):
+    if directory and not os.path.isdir(directory):
+        raise ValueError(f'Exec directory {directory} does not exist')
+    if wrapper and not shutil.which(wrapper[0]):
+        raise ValueError(f'Sandbox wrapper {wrapper[0]} is not installed')
+    if wrapper and os.path.basename(wrapper[0]) == 'chroot' and os.geteuid() != 0:
+        raise ValueError('Sandboxing with chroot requires the bot to run as root')
+    if wrapper and os.path.basename(wrapper[0]) == 'chroot' and credentials:
+        # The user switch happens before chroot runs, and chroot then lacks the privilege to change root.
+        raise ValueError('EXEC_USER cannot be combined with chroot, use chroot --userspec in EXEC_WRAPPER instead')
+
+
+def command_args(command, wrapper=()):
+    return [*wrapper, 'sh', '-c', command]
+
+
+def run(command, wrapper=(), timeout=None, **kwargs):
+    # The command gets its own session so a timeout kills everything it spawned,
+    # not just the shell; otherwise a child like `tail -f` keeps the pipe open.
+    child = subprocess.Popen(
+        command_args(command, wrapper),
+        stdout=subprocess.PIPE,
+        stderr=subprocess.STDOUT,
+        start_new_session=True,
+        **kwargs
+    )
+    try:
+        output, _ = child.communicate(timeout=timeout)
+    except subprocess.TimeoutExpired:
+        try:
+            os.killpg(child.pid, signal.SIGKILL)
+        except ProcessLookupError:
+            pass
+        try:
+            output, _ = child.communicate(timeout=DRAIN_TIMEOUT)
+        except subprocess.TimeoutExpired as error:
+            # Something that left the session with setsid still holds the pipe open.
+            output = error.output or b''
+            child.stdout.close()
+            child.wait()
+        raise subprocess.TimeoutExpired(child.args, timeout, output=output.decode(errors='replace'))
+    return child.returncode, output.decode(errors='replace')
+
+
+def run_args(args, timeout=None):
+    result = subprocess.run(
+        args,
+        stdout=subprocess.PIPE,
+        stderr=subprocess.STDOUT,
+        timeout=timeout
+    )
+    return result.returncode, result.stdout.decode(errors='replace')
@@ -1,9 +1,23 @@
+import logging
+import math
+import secrets
+import threading
+import time
+
+from telegram import InlineKeyboardButton, InlineKeyboardMarkup
+from telegram.error import BadRequest, NetworkError, RetryAfter, TimedOut
+from telegram.ext import CallbackQueryHandler
 from telegram.ext.commandhandler import CommandHandler
 from telegram.ext.updater import Updater
 
+CONFIRMATION_TIMEOUT = 60
+SEND_ATTEMPTS = 3
+
 
 class TelegramBot(Updater):
     __registry = {}
+    command_cooldowns = {}
+    duplicate_window = 0
 
     @property
     def registered_commands(self):
@@ -11,13 +25,154 @@ class TelegramBot(Updater):
 
     def __init__(self, *args, **kwargs):
         super().__init__(*args, **kwargs)
+        # Replies go through the same bot methods, so every message sent or edited is redacted and retried.
+        self.bot.send_message = self.__redacting(self.__with_retries(self.bot.send_message, False), 1)
+        self.bot.edit_message_text = self.__redacting(self.__with_retries(self.bot.edit_message_text, True), 0)
+        self.bot.send_document = self.__redacting(self.bot.send_document, None)
+        self.__pending_actions = {}
+        self.__last_invocations = {}
+        self.__last_commands = {}
+        self.__last_buttons = {}
+        self.audit_outcome = threading.local()
 
         methods = [getattr(self, name) for name in dir(self) if not name.startswith('_')]
         commands = filter(lambda fn: getattr(fn, 'bot_command', False), methods)
 
         for command in commands:
             self.__registry[command.name] = command.description
-            self.dispatcher.add_handler(CommandHandler(command.name, command))
+            self.dispatcher.add_handler(CommandHandler(command.name, self.__with_cooldown(command)))
+
+        self.add_button_handler(self.__handle_confirmation, r'^(confirm|cancel):')
+
+    def add_button_handler(self, callback, pattern):
+        def handler(bot, update):
+            query = update.callback_query
+            previous_data, previous_time = self.__last_buttons.get(query.from_user.id, (None, 0))
+            if query.data == previous_data and time.time() - previous_time < self.duplicate_window:
+                logging.info('Ignored duplicate button %s from user %s', query.data, query.from_user.id)
+                query.answer()
+                self.audit(update, 'ignored duplicate')
+                return
+            self.__last_buttons[query.from_user.id] = (query.data, time.time())
+
+            self.audit_outcome.result, self.audit_outcome.command = 'allowed', None
+            try:
+                return callback(bot, update)
+            finally:
+                self.audit(update, self.audit_outcome.result)
+        self.dispatcher.add_handler(CallbackQueryHandler(handler, pattern=pattern))
+
+    def __with_cooldown(self, command):
+        def handler(bot, update):
+            user_id, text = update.message.from_user.id, update.message.text
+            previous_text, previous_time = self.__last_commands.get(user_id, (None, 0))
+            if text == previous_text and time.time() - previous_time < self.duplicate_window:
+                logging.info('Ignored duplicate %s from user %s', text, user_id)
+                self.audit(update, 'ignored duplicate')
+                return
+            self.__last_commands[user_id] = (text, time.time())
+
+            cooldown = self.command_cooldowns.get(command.name, 0)
+            key = (update.message.from_user.id, command.name)
+            remaining = self.__last_invocations.get(key, 0) + cooldown - time.time()
+            if remaining > 0:
+                update.message.reply_text(f'/{command.name} is cooling down, try again in {math.ceil(remaining)}s')
+                self.audit(update, 'cooling down')
+                return
+
+            self.__last_invocations[key] = time.time()
+            # Handlers run on the calling thread, so a command can report a block through audit_outcome.
+            self.audit_outcome.result, self.audit_outcome.command = 'allowed', None
+            try:
+                return command(bot, update)
+            finally:
+                self.audit(update, self.audit_outcome.result)
+        return handler
+
+    def audit(self, update, result):
+        pass
+
+    def redact(self, text):
+        return text
+
+    def __redacting(self, send, text_position):
+        def send_redacted(*args, **kwargs):
+            if text_position is not None and len(args) > text_position:
+                args = list(args)
+                args[text_position] = self.redact(args[text_position])
+            for name in ('text', 'caption'):
+                if kwargs.get(name):
+                    kwargs[name] = self.redact(kwargs[name])
+            return send(*args, **kwargs)
+        return send_redacted
+
+    @staticmethod
+    def __with_retries(send, retry_timeouts):
+        # A timed out send may still have been delivered, so only idempotent calls retry timeouts.
+        def send_with_retries(*args, **kwargs):
+            for attempt in range(1, SEND_ATTEMPTS + 1):
+                try:
+                    return send(*args, **kwargs)
+                except BadRequest:
+                    raise
+                except TimedOut:
+                    if not retry_timeouts or attempt == SEND_ATTEMPTS:
+                        raise
+                    delay = 2 ** attempt
+                except RetryAfter as error:
+                    if attempt == SEND_ATTEMPTS:
+                        raise
+                    delay = error.retry_after
+                except NetworkError:
+                    if attempt == SEND_ATTEMPTS:
+                        raise
+                    delay = 2 ** attempt
+                logging.warning('%s failed (attempt %d), retrying in %ss', send.__name__, attempt, delay)
+                time.sleep(delay)
+        return send_with_retries
+
+    def send_message(self, chat_id, text, **kwargs):
+        return self.bot.send_message(chat_id=chat_id, text=text, **kwargs)
+
+    def require_confirmation(self, update, description, action):
+        token = secrets.token_hex(4)
+        expires_at = time.time() + CONFIRMATION_TIMEOUT
+        self.__pending_actions[update.effective_user.id] = (token, expires_at, action)
+
+        keyboard = InlineKeyboardMarkup([[
+            InlineKeyboardButton('✅ Confirm', callback_data=f'confirm:{token}'),
+            InlineKeyboardButton('❌ Cancel', callback_data=f'cancel:{token}')
+        ]])
+        update.effective_message.reply_text(description, reply_markup=keyboard)
+
+    def discard_confirmation(self, user_id):
+        return self.__pending_actions.pop(user_id, None) is not None
+
+    def __handle_confirmation(self, bot, update):
+        query = update.callback_query
+        choice, token = query.data.split(':', 1)
+        query.answer()
+
+        self.audit_outcome.command = query.message.text
+        pending = self.__pending_actions.get(query.from_user.id)
+        if pending is None or pending[0] != token:
+            self.audit_outcome.result = 'no longer valid'
+            query.edit_message_text(f'{query.message.text}\n\nThis confirmation is no longer valid')
+            return
+        # Popping before running makes a second tap on the same button a no-op.
+        self.__pending_actions.pop(query.from_user.id, None)
+
+        _, expires_at, action = pending
+        if time.time() > expires_at:
+            self.audit_outcome.result = 'expired'
+            query.edit_message_text(f'{query.message.text}\n\nConfirmation expired')
+        elif choice == 'cancel':
+            self.audit_outcome.result = 'cancelled'
+            query.edit_message_text(f'{query.message.text}\n\nCancelled')
+        else:
+            self.audit_outcome.result = 'confirmed'
+            query.edit_message_text(f'{query.message.text}\n\nConfirmed')
+            action(query.message)
 
     def run(self):
         self.start_polling()
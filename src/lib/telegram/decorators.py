@@ -11,6 +11,31 @@ def admin_required(func):
     def wrapper(self, bot, update):
         from_user = update.message.from_user.username
         if from_user in self.admins:
+            self.admin_chats[from_user] = update.message.chat_id
             return func(self, bot, update)
-        update.message.reply_text(f'You don\'t have access to run this command')
+        if from_user in self.viewers:
+            if getattr(func, 'viewer_allowed', False):
+                return func(self, bot, update)
+            self.command_blocked(update, 'viewer')
+            update.message.reply_text('This command requires an admin')
+            return
+
+        self.command_blocked(update, 'unauthorized user')
+        if not self.silent_unauthorized:
+            update.message.reply_text(self.unauthorized_message)
+    return wrapper
+
+
+def viewer_allowed(func):
+    func.viewer_allowed = True
+    return func
+
+
+def state_changing(func):
+    def wrapper(self, bot, update):
+        if self.read_only:
+            self.command_blocked(update, 'read-only mode')
+            update.message.reply_text('Bot is in read-only mode')
+            return
+        return func(self, bot, update)
     return wrapper
@@ -1,16 +1,277 @@
+import importlib
+import html
+import json
+import logging
+import math
 import os
+import platform
+import pwd
+import re
+import secrets
+import shutil
+import signal
+import subprocess
+import sys
+import tempfile
+import threading
+import time
+from collections import deque
+from urllib.parse import urlparse
+
+import telegram
+from telegram import (
+    InlineKeyboardButton, InlineKeyboardMarkup, InlineQueryResultArticle, InputTextMessageContent, ParseMode,
+    ReplyKeyboardMarkup, ReplyKeyboardRemove
+)
+from telegram.error import TelegramError, Unauthorized
+from telegram.ext import InlineQueryHandler
 
 from .lib.telegram import TelegramBot
-from .lib.telegram.decorators import bot_command, admin_required
+from .lib.telegram.decorators import bot_command, admin_required, state_changing, viewer_allowed
+from .lib.system import auth, benchmark, diagnostics, files, jobs, metrics, mounts, network, process, resources, shell
 from . import config
 
+MOUNT_ARGUMENT = re.compile(r'^[\w/.@:-]+$')
+SHELL_OPERATORS = re.compile(r'[;&|`$<>(){}\n\\]')
+SERVICE_NAME = re.compile(r'^[a-zA-Z0-9@._-]+$')
+SERVICE_ACTIONS = ('start', 'stop', 'restart', 'status')
+USERNAME = re.compile(r'^[A-Za-z0-9_]{5,32}$')
+ADMINS_FILE_INTERVAL = 30
+MAX_LOG_LINES = 200
+MAX_AUTH_LINES = 5000
+MAX_MESSAGE_LENGTH = 4000
+JOB_OUTPUT_TAIL = 1000
+# Extra room so multi-byte characters and secrets crossing the cut are still decoded and redacted.
+JOB_OUTPUT_BUFFER = 4 * JOB_OUTPUT_TAIL
+MAX_COMPRESS_SIZE = 1024 ** 3
+MAX_WALK_ENTRIES = 100000
+LOGIN_ALERT_COOLDOWN = 60
+FD_ALERT_INTERVAL = 60
+ALERT_RATE_LIMIT = 10
+ALERT_RATE_WINDOW = 60
+PROCESS_LIMIT = 10
+PROCESS_KILL_BUTTONS = 5
+ADMIN_KEYBOARD = [['/processes', '/fd', '/ip'], ['/jobs', '/whoami', '/help']]
+VIEWER_KEYBOARD = [['/processes', '/fd', '/ip'], ['/dashboard', '/whoami', '/help']]
+GUEST_KEYBOARD = [['/help']]
+DASHBOARD_KEYBOARD = InlineKeyboardMarkup([[InlineKeyboardButton('🔄 Refresh', callback_data='dashboard')]])
+FULL_OUTPUT_TTL = 600
+MEMORY_FIELDS = (
+    ('Used', None), ('Free', 'MemFree'), ('Available', 'MemAvailable'), ('Buffers', 'Buffers'),
+    ('Cached', 'Cached'), ('Shared', 'Shmem'), ('Slab', 'Slab'), ('  reclaimable', 'SReclaimable'),
+    ('  unreclaimable', 'SUnreclaim'), ('Active', 'Active'), ('Inactive', 'Inactive'), ('Dirty', 'Dirty')
+)
+RESTART_CHAT_VARIABLE = 'RADMIN_RESTART_CHAT_ID'
+COUNTDOWN_REMINDERS = (60, 30, 15, 10, 5, 1)
+TAIL_INTERVAL = 3
+SEVERITY_MARKERS = (
+    (re.compile(r'\b(CRITICAL|ERROR|FATAL|Traceback)\b'), '🔴'),
+    (re.compile(r'\b(WARNING|WARN)\b'), '🟡')
+)
+LIVE_OPTIONS = (
+    'admins', 'viewers', 'read_only', 'mount_devices', 'mount_points', 'start_status', 'power_commands',
+    'unauthorized_message', 'silent_unauthorized', 'command_timeouts',
+    'persistent_keyboard', 'redact_values', 'allow_restart', 'command_cooldowns',
+    'alert_on_blocked', 'duplicate_window', 'monitored_mounts', 'tail_duration',
+    'kill_grace_period', 'audit_file', 'allowed_commands'
+)
+# Config names that bot_options and the metrics server read from the environment, the rest are config file only.
+ENV_OPTIONS = (
+    'API_TOKEN_KEY', 'ADMINS', 'VIEWERS', 'ADMINS_FILE', 'READ_ONLY', 'LOG_FILE', 'START_STATUS', 'EXEC_USER',
+    'EXEC_DIR', 'POWER_COMMANDS', 'UNAUTHORIZED_MESSAGE', 'SILENT_UNAUTHORIZED', 'ALERT_ON_LOGIN',
+    'PERSISTENT_KEYBOARD', 'ALLOW_RESTART', 'ALERT_ON_BLOCKED', 'DUPLICATE_WINDOW', 'TAIL_DURATION',
+    'KILL_GRACE_PERIOD', 'AUDIT_FILE', 'WEBHOOK_URL', 'WEBHOOK_LISTEN', 'WEBHOOK_PORT', 'API_ENDPOINT',
+    'METRICS_HOST', 'METRICS_PORT', 'FD_ALERT_PERCENT'
+)
+
+
+def mark_severity(line):
+    for pattern, marker in SEVERITY_MARKERS:
+        if pattern.search(line):
+            return f'{marker} {line}'
+    return line
+
 
 class Bot(TelegramBot):
-    admins = []
+    configured_admins = []
+    viewers = []
+    file_admins = []
+    read_only = False
+    mount_devices = []
+    mount_points = []
+    log_file = ''
+    start_status = True
+    exec_credentials = {}
+    exec_dir = ''
+    exec_wrapper = []
+    power_commands = False
+    unauthorized_message = 'You don\'t have access to run this command'
+    silent_unauthorized = False
+    alert_on_login = False
+    command_timeouts = {}
+    persistent_keyboard = False
+    redact_values = []
+    allow_restart = False
+    alert_on_blocked = False
+    monitored_mounts = ['/']
+    tail_duration = 600
+    kill_grace_period = 5
+    audit_file = ''
+    allowed_commands = []
+    webhook_url = ''
+    webhook_listen = '127.0.0.1'
+    webhook_port = 8443
+    fd_alert_percent = 0
+    aliases = {}
 
     def __init__(self, *args, **kwargs):
-        self.admins = kwargs.pop('admins', [])
+        self.startup_options = dict(kwargs)
+        self.shard = kwargs.pop('shard', None)
+        self.configured_admins = list(kwargs.pop('admins', []))
+        self.viewers = list(kwargs.pop('viewers', []))
+        self.admins_file = kwargs.pop('admins_file', '')
+        self.file_admins = []
+        self.admins_file_mtime = None
+        self.read_only = kwargs.pop('read_only', False)
+        self.mount_devices = kwargs.pop('mount_devices', [])
+        self.mount_points = kwargs.pop('mount_points', [])
+        self.log_file = kwargs.pop('log_file', '')
+        self.start_status = kwargs.pop('start_status', True)
+        self.exec_credentials = shell.credentials(kwargs.pop('exec_user', ''))
+        self.exec_dir = kwargs.pop('exec_dir', '')
+        self.exec_wrapper = kwargs.pop('exec_wrapper', [])
+        shell.validate_sandbox(self.exec_dir, self.exec_wrapper, self.exec_credentials)
+        self.power_commands = kwargs.pop('power_commands', False)
+        self.unauthorized_message = kwargs.pop('unauthorized_message', self.unauthorized_message)
+        self.silent_unauthorized = kwargs.pop('silent_unauthorized', False)
+        self.alert_on_login = kwargs.pop('alert_on_login', False)
+        self.login_alerts = {}
+        self.alert_times = deque()
+        self.alert_stats = {}
+        self.alert_lock = threading.Lock()
+        self.full_outputs = {}
+        self.started = time.time()
+        self.command_timeouts = kwargs.pop('command_timeouts', {})
+        self.persistent_keyboard = kwargs.pop('persistent_keyboard', False)
+        self.redact_values = kwargs.pop('redact_values', [])
+        self.allow_restart = kwargs.pop('allow_restart', False)
+        self.alert_on_blocked = kwargs.pop('alert_on_blocked', False)
+        self.command_cooldowns = kwargs.pop('command_cooldowns', {})
+        self.duplicate_window = kwargs.pop('duplicate_window', 0)
+        self.monitored_mounts = kwargs.pop('monitored_mounts', ['/'])
+        self.tail_duration = kwargs.pop('tail_duration', 600)
+        self.kill_grace_period = kwargs.pop('kill_grace_period', 5)
+        self.audit_file = kwargs.pop('audit_file', '')
+        self.allowed_commands = kwargs.pop('allowed_commands', [])
+        self.audit_lock = threading.Lock()
+        self.webhook_url = kwargs.pop('webhook_url', '').rstrip('/')
+        self.webhook_listen = kwargs.pop('webhook_listen', '127.0.0.1')
+        self.webhook_port = kwargs.pop('webhook_port', 8443)
+        self.fd_alert_percent = kwargs.pop('fd_alert_percent', 0)
+        self.aliases = {}
+        self.admin_chats = {}
+        self.jobs = jobs.JobRegistry()
+        self.tails = {}
         super().__init__(*args, **kwargs)
+        self.dispatcher.add_handler(InlineQueryHandler(self.inline_query))
+        self.add_button_handler(self.cancel_reboot, r'^cancel_reboot$')
+        self.add_button_handler(self.process_action, r'^(sort|kill):')
+        self.add_button_handler(self.refresh_dashboard, r'^dashboard$')
+        self.add_button_handler(self.send_full_output, r'^output:')
+
+    @property
+    def admins(self):
+        return self.configured_admins + self.file_admins
+
+    @admins.setter
+    def admins(self, admins):
+        self.configured_admins = list(admins)
+
+    def load_admins_file(self):
+        try:
+            mtime = os.stat(self.admins_file).st_mtime
+        except FileNotFoundError:
+            if self.file_admins:
+                logging.warning('The admins file was removed, revoking its admins')
+            self.file_admins = []
+            self.admins_file_mtime = None
+            return
+        except OSError as error:
+            logging.warning('Could not read the admins file: %s', error)
+            return
+        if mtime == self.admins_file_mtime:
+            return
+
+        admins = []
+        try:
+            with open(self.admins_file) as admins_file:
+                lines = admins_file.readlines()
+        except FileNotFoundError:
+            self.file_admins = []
+            self.admins_file_mtime = None
+            return
+        except (OSError, UnicodeDecodeError) as error:
+            logging.warning('Could not read the admins file, keeping the previous admins: %s', error)
+            return
+        for number, line in enumerate(lines, 1):
+            username = line.split('#', 1)[0].strip().lstrip('@')
+            if not username:
+                continue
+            if USERNAME.match(username):
+                admins.append(username)
+            else:
+                logging.warning('Ignoring malformed username on line %d of the admins file', number)
+
+        self.admins_file_mtime = mtime
+        self.file_admins = admins
+        logging.info('Loaded %d admins from %s', len(admins), self.admins_file)
+
+    def watch_admins_file(self):
+        while True:
+            self.load_admins_file()
+            time.sleep(ADMINS_FILE_INTERVAL)
+
+    def inline_query(self, bot, update):
+        query = update.inline_query
+        if query.from_user.username not in self.admins + self.viewers:
+            query.answer([], cache_time=0, is_personal=True)
+            return
+
+        reports = {
+            'status': lambda: resources.summary(self.monitored_mounts),
+            'resources': lambda: resources.usage_report(self.monitored_mounts),
+            'uptime': lambda: f'Uptime: {resources.uptime()}'
+        }
+        keyword = query.query.strip().lower()
+        results = [
+            InlineQueryResultArticle(
+                id=name,
+                title=name.capitalize(),
+                input_message_content=InputTextMessageContent(report())
+            )
+            for name, report in reports.items() if name.startswith(keyword)
+        ]
+        query.answer(results, cache_time=0, is_personal=True)
+
+    @bot_command(name='start', description='Show the welcome message')
+    def start(self, bot, update):
+        greeting = 'Remote administrator bot. Send /help to list the commands.'
+        if self.start_status and update.message.from_user.username in self.admins + self.viewers:
+            greeting += f'\n\n{resources.summary(self.monitored_mounts)}'
+
+        keyboard = None
+        if self.persistent_keyboard:
+            keyboard = self.main_keyboard(update.message.from_user.username)
+        update.message.reply_text(greeting, reply_markup=keyboard)
+
+    def main_keyboard(self, username):
+        if username in self.admins:
+            rows = ADMIN_KEYBOARD
+        elif username in self.viewers:
+            rows = VIEWER_KEYBOARD
+        else:
+            rows = GUEST_KEYBOARD
+        return ReplyKeyboardMarkup(rows, resize_keyboard=True)
 
     @bot_command(name='help', description='List all commands')
     def help_command(self, bot, update):
@@ -19,25 +280,1335 @@ class Bot(TelegramBot):
             self.registered_commands.keys()
         )
         commands = '\n'.join(commands)
+        mode = '\n\nThe bot is in read-only mode.' if self.read_only else ''
         update.message.reply_text(
-            'The commands you can execute are: \n\n{commands}'.format(
+            'The commands you can execute are: \n\n{commands}{mode}'.format(
                 name=update.message.from_user.first_name,
-                commands=commands
+                commands=commands,
+                mode=mode
             )
         )
 
     @bot_command(name='exec', description='Execute a bash command')
     @admin_required
+    @state_changing
     def bash(self, bot, update):
 
         message = update.message.text.replace('/exec', '')
-        command = os.popen(message).read()
-        update.message.reply_text(f'$ {message}\n{command}')
+        mode = message.split()[:1]
+        if mode in (['--out'], ['--bg']):
+            message = message.replace(mode[0], '', 1).strip()
+        if not self.exec_permitted(update, message):
+            return
+        if mode == ['--out']:
+            return self.send_output_file(update, message)
+        if mode == ['--bg']:
+            return self.execute_in_background(update, message)
+        self.execute(update, message)
+
+    def exec_permitted(self, update, message):
+        if not self.allowed_commands:
+            return True
+        # With an allowlist, shell syntax could chain an allowed command to any other one.
+        words = message.split()
+        if not SHELL_OPERATORS.search(message) and any(
+            words[:len(allowed.split())] == allowed.split() for allowed in self.allowed_commands
+        ):
+            return True
+
+        self.command_blocked(update, 'not in the allowed commands')
+        update.message.reply_text('Command is not in the allowed list: ' + ', '.join(self.allowed_commands))
+        return False
+
+    def redact(self, output):
+        # Every bot shares the process, so any of their tokens can show up in command output.
+        secrets = [*bot_tokens(), *self.redact_values]
+        for secret in filter(None, secrets):
+            output = output.replace(secret, '[REDACTED]')
+        return output
+
+    def exec_options(self):
+        return {**self.exec_credentials, 'cwd': self.exec_dir or None}
+
+    def command_timeout(self, command):
+        return self.command_timeouts.get(command, self.command_timeouts.get('default', 30))
+
+    def execute(self, update, message):
+        timeout = self.command_timeout('exec')
+        try:
+            _, output = shell.run(message, self.exec_wrapper, timeout=timeout, **self.exec_options())
+        except subprocess.TimeoutExpired as error:
+            output = f'{error.output or ""}\n(command timed out after {timeout}s)'.lstrip()
+        except OSError as error:
+            update.message.reply_text(f'Could not run the command: {error}')
+            return
+
+        text = f'$ {message}\n{self.redact(output)}'
+        if len(text) <= MAX_MESSAGE_LENGTH:
+            update.message.reply_text(text)
+            return
+
+        now = time.time()
+        for token, (expires_at, *_) in list(self.full_outputs.items()):
+            if expires_at < now:
+                del self.full_outputs[token]
+        token = secrets.token_hex(4)
+        self.full_outputs[token] = (now + FULL_OUTPUT_TTL, update.message.from_user.username, text)
+
+        keyboard = InlineKeyboardMarkup([[InlineKeyboardButton('📎 Full output', callback_data=f'output:{token}')]])
+        update.message.reply_text(f'{text[:MAX_MESSAGE_LENGTH - 20]}\n... (truncated)', reply_markup=keyboard)
+
+    def send_full_output(self, bot, update):
+        query = update.callback_query
+        query.answer()
+        stored = self.full_outputs.get(query.data.split(':', 1)[1])
+        if stored is None or stored[0] < time.time() or stored[1] != query.from_user.username:
+            self.audit_outcome.result = 'no longer available'
+            query.message.reply_text('The full output is no longer available')
+            return
+        self.send_document(query.message, stored[2], 'Full output')
+
+    def execute_in_background(self, update, message):
+        try:
+            command = subprocess.Popen(
+                shell.command_args(message, self.exec_wrapper),
+                stdout=subprocess.PIPE,
+                stderr=subprocess.STDOUT,
+                start_new_session=True,
+                **self.exec_options()
+            )
+        except OSError as error:
+            update.message.reply_text(f'Could not start the job: {error}')
+            return
+        job = self.jobs.add(
+            update.message.from_user.username, 'exec', message,
+            lambda: process.signal_group(command.pid, signal.SIGTERM)
+        )
+        chat_id = update.message.chat_id
+
+        def wait():
+            # Only the tail is reported, so long running jobs must not buffer their whole output.
+            tail = b''
+            for chunk in iter(lambda: command.stdout.read(4096), b''):
+                tail = (tail + chunk)[-JOB_OUTPUT_BUFFER:]
+            command.stdout.close()
+            command.wait()
+            output = self.redact(tail.decode(errors='replace'))
+            if self.jobs.remove(job.id) is None:
+                output += '\n(cancelled)'
+            self.bot.send_message(
+                chat_id=chat_id,
+                text=f'Job {job.id} finished with exit code {command.returncode}\n'
+                     f'$ {message}\n{output[-JOB_OUTPUT_TAIL:]}'
+            )
+
+        threading.Thread(target=wait, daemon=True).start()
+        update.message.reply_text(f'Started job {job.id}: {message}')
+
+    def send_output_file(self, update, message):
+        timeout = self.command_timeout('exec')
+        try:
+            exit_code, output = shell.run(message, self.exec_wrapper, timeout=timeout, **self.exec_options())
+        except subprocess.TimeoutExpired as error:
+            if not error.output:
+                update.message.reply_text(f'Command timed out after {timeout}s')
+                return
+            exit_code, output = 'timed out', f'{error.output}\n(command timed out after {timeout}s)'
+        except OSError as error:
+            update.message.reply_text(f'Could not run the command: {error}')
+            return
+
+        output = self.redact(output)
+        head = '\n'.join(output.splitlines()[:5])
+        summary = f'$ {message}\nExit code: {exit_code}, {len(output.encode())} bytes\n{head}'
+        self.send_document(update.message, output, summary)
+
+    def send_document(self, message, output, caption):
+        with tempfile.NamedTemporaryFile('w+b', suffix='.txt') as output_file:
+            output_file.write(output.encode())
+            output_file.seek(0)
+            message.reply_document(
+                document=output_file,
+                filename='output.txt',
+                caption=caption[:1024]
+            )
+
+    @bot_command(name='killtree', description='Kill a process and all its children')
+    @admin_required
+    @state_changing
+    def kill_tree(self, bot, update):
+        args = update.message.text.split()[1:]
+        if not args or not args[0].isdigit():
+            update.message.reply_text('Usage: /killtree <pid>')
+            return
+
+        pid = int(args[0])
+        if not process.is_running(pid):
+            update.message.reply_text(f'No process with PID {pid}')
+            return
+
+        tree = process.process_tree(pid)
+        protected = {1, os.getpid()}.intersection(tree)
+        if protected:
+            pids = ', '.join(map(str, sorted(protected)))
+            update.message.reply_text(f'Refusing to kill a tree containing protected PIDs: {pids}')
+            return
+
+        pids = ' '.join(map(str, tree))
+        self.require_confirmation(
+            update,
+            f'This will terminate PIDs: {pids}',
+            lambda message: self.terminate_processes(message, tree)
+        )
+
+    @bot_command(name='kill', description='Kill a single process after confirming its name: /kill [-9] <pid>')
+    @admin_required
+    @state_changing
+    def kill(self, bot, update):
+        args = update.message.text.split()[1:]
+        force = args[:1] == ['-9']
+        args = args[1:] if force else args
+        if len(args) != 1 or not args[0].isdigit():
+            update.message.reply_text('Usage: /kill [-9] <pid>')
+            return
+
+        pid = int(args[0])
+        if pid in (1, os.getpid()):
+            update.message.reply_text(f'Refusing to kill PID {pid}')
+            return
+        self.confirm_kill(update, pid, force)
+
+    @bot_command(name='processes', description='Show the top processes by CPU, or by memory with /processes mem')
+    @admin_required
+    @viewer_allowed
+    def processes(self, bot, update):
+        args = update.message.text.split()[1:]
+        sort = 'mem' if args[:1] == ['mem'] else 'cpu'
+        text, keyboard = self.process_table(sort)
+        update.message.reply_text(text, reply_markup=keyboard, parse_mode=ParseMode.HTML)
+
+    def process_table(self, sort, page=0):
+        processes = process.top_processes(sort, None)
+        pages = max(1, math.ceil(len(processes) / PROCESS_LIMIT))
+        page = min(max(page, 0), pages - 1)
+        top = processes[page * PROCESS_LIMIT:(page + 1) * PROCESS_LIMIT]
+        rows = '\n'.join(
+            '{pid:>7} {cpu:>5.1f} {mem:>5.1f} {name}'.format(**info) for info in top
+        )
+        # Every page is its own complete <pre> block, so paging never splits one.
+        text = '<pre>{header}\n{rows}</pre>\nPage {page} of {pages}'.format(
+            header=f'{"PID":>7} {"CPU%":>5} {"MEM%":>5} NAME',
+            rows=html.escape(rows),
+            page=page + 1,
+            pages=pages
+        )
+
+        other = 'mem' if sort == 'cpu' else 'cpu'
+        navigation = [InlineKeyboardButton(f'Sort by {other.upper()}', callback_data=f'sort:{other}')]
+        if page > 0:
+            navigation.insert(0, InlineKeyboardButton('◀ Prev', callback_data=f'sort:{sort}:{page - 1}'))
+        if page < pages - 1:
+            navigation.append(InlineKeyboardButton('Next ▶', callback_data=f'sort:{sort}:{page + 1}'))
+        buttons = [navigation]
+        buttons.extend(
+            [InlineKeyboardButton(f'🗑 kill {info["pid"]} {info["name"]}'[:40], callback_data=f'kill:{info["pid"]}')]
+            for info in top[:PROCESS_KILL_BUTTONS]
+        )
+        return text, InlineKeyboardMarkup(buttons)
+
+    def process_action(self, bot, update):
+        query = update.callback_query
+        query.answer()
+        username = query.from_user.username
+        if username not in self.admins + self.viewers:
+            self.audit_outcome.result = 'blocked: unauthorized user'
+            return
+
+        action, value = query.data.split(':', 1)
+        if action == 'sort':
+            sort, _, page = value.partition(':')
+            if sort not in ('cpu', 'mem') or not (page or '0').isdigit():
+                self.audit_outcome.result = 'invalid button'
+                return
+            text, keyboard = self.process_table(sort, int(page or 0))
+            query.edit_message_text(text, reply_markup=keyboard, parse_mode=ParseMode.HTML)
+            return
+        if username not in self.admins:
+            self.audit_outcome.result = 'blocked: viewer'
+            query.message.reply_text('Killing processes requires an admin')
+            return
+
+        if not value.isdigit():
+            self.audit_outcome.result = 'invalid button'
+            return
+        pid = int(value)
+        if self.read_only or pid in (1, os.getpid()):
+            self.audit_outcome.result = 'blocked: read-only mode or protected PID'
+            query.message.reply_text(f'Refusing to kill PID {pid}')
+            return
+        self.confirm_kill(update, pid)
+
+    def confirm_kill(self, update, pid, force=False):
+        try:
+            name, _ = process.read_stat(pid)
+        except OSError:
+            update.effective_message.reply_text(f'No process with PID {pid}')
+            return
+        self.require_confirmation(
+            update,
+            f'Kill PID {pid} ({name}) with {"SIGKILL" if force else "SIGTERM"}?',
+            lambda message: self.terminate_processes(message, [pid], force)
+        )
+
+    @bot_command(name='ps', description='Show details of a single process: /ps <pid>')
+    @admin_required
+    def process_details(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 1 or not args[0].isdigit():
+            update.message.reply_text('Usage: /ps <pid>')
+            return
+
+        try:
+            info = process.details(int(args[0]))
+        except (FileNotFoundError, ProcessLookupError):
+            update.message.reply_text(f'No process with PID {args[0]}')
+            return
+
+        open_files = 'unknown' if info['open_files'] is None else info['open_files']
+        started = time.strftime('%Y-%m-%d %H:%M:%S', time.localtime(info['started']))
+        update.message.reply_text(
+            f'PID: {info["pid"]} ({info["name"]})\n'
+            f'Command: {info["cmdline"]}\n'
+            f'Status: {info["status"]}, user: {info["user"]}, parent: {info["ppid"]}\n'
+            f'CPU: {info["cpu"]:.1f}%\n'
+            f'Memory: RSS {resources.format_bytes(info["rss"])}, VMS {resources.format_bytes(info["vms"])}\n'
+            f'Threads: {info["threads"]}, open files: {open_files}\n'
+            f'Started: {started}'
+        )
+
+    def terminate_processes(self, message, pids, force=False):
+        signaled = process.terminate(pids, self.kill_grace_period, force)
+        results = '\n'.join(f'{pid}: {result}' for pid, result in signaled.items())
+        message.reply_text(f'Signaled processes:\n{results or "none"}')
+
+    @bot_command(name='mount', description='Mount an allowed device')
+    @admin_required
+    @state_changing
+    def mount(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 2:
+            update.message.reply_text('Usage: /mount <device> <mountpoint>')
+            return
+
+        device, mountpoint = args
+        if device not in self.mount_devices or mountpoint not in self.mount_points:
+            update.message.reply_text('Device or mountpoint is not in the allowed list')
+            return
+        self.confirm_mount_command(update, ['mount', device, mountpoint], mountpoint)
+
+    @bot_command(name='umount', description='Unmount an allowed device or mountpoint')
+    @admin_required
+    @state_changing
+    def umount(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 1:
+            update.message.reply_text('Usage: /umount <device|mountpoint>')
+            return
+
+        target = args[0]
+        if target not in self.mount_devices and target not in self.mount_points:
+            update.message.reply_text('Target is not in the allowed list')
+            return
+        self.confirm_mount_command(update, ['umount', target], target)
+
+    def confirm_mount_command(self, update, args, target):
+        if not all(MOUNT_ARGUMENT.match(arg) for arg in args):
+            update.message.reply_text('Arguments contain invalid characters')
+            return
+
+        self.require_confirmation(
+            update,
+            f'Run {" ".join(args)}?',
+            lambda message: self.run_mount_command(message, args, target)
+        )
+
+    def run_mount_command(self, message, args, target):
+        timeout = self.command_timeout(args[0])
+        try:
+            exit_code, output = shell.run_args(args, timeout=timeout)
+        except subprocess.TimeoutExpired:
+            message.reply_text(f'{args[0]} timed out after {timeout}s')
+            return
+
+        status = 'succeeded' if exit_code == 0 else f'failed with exit code {exit_code}'
+        message.reply_text(
+            f'$ {" ".join(args)}\n{output}\n{args[0]} {status}\n{mounts.mount_state(target)}'
+        )
+
+    @bot_command(name='service', description='Control a systemd service: start, stop, restart or status <name>')
+    @admin_required
+    def service(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 2 or args[0] not in SERVICE_ACTIONS:
+            update.message.reply_text(f'Usage: /service <{"|".join(SERVICE_ACTIONS)}> <name>')
+            return
+
+        action, name = args
+        if not SERVICE_NAME.match(name):
+            update.message.reply_text('Service name contains invalid characters')
+            return
+        if action != 'status' and self.read_only:
+            self.command_blocked(update, 'read-only mode')
+            update.message.reply_text('Bot is in read-only mode')
+            return
+
+        timeout = self.command_timeout('service')
+        try:
+            if action != 'status':
+                exit_code, output = shell.run_args(['systemctl', action, '--', name], timeout=timeout)
+                if exit_code != 0:
+                    update.message.reply_text(f'systemctl {action} {name} failed with exit code {exit_code}\n{output}')
+                    return
+            # systemctl status exits non-zero for stopped units, so its code is not an error here.
+            _, status = shell.run_args(['systemctl', 'status', '--no-pager', '--', name], timeout=timeout)
+        except (OSError, subprocess.TimeoutExpired) as error:
+            update.message.reply_text(f'systemctl {action} {name} failed: {error}')
+            return
+
+        header = f'systemctl {action} {name} succeeded\n' if action != 'status' else ''
+        update.message.reply_text(f'{header}{status}'[:MAX_MESSAGE_LENGTH])
+
+    @bot_command(name='botlog', description='Show the last lines of the bot log, -m to mark errors and warnings')
+    @admin_required
+    def bot_log(self, bot, update):
+        if not self.log_file:
+            update.message.reply_text('No log file is configured')
+            return
+
+        args = update.message.text.split()[1:]
+        marked = '-m' in args
+        args = [arg for arg in args if arg != '-m']
+        lines = int(args[0]) if args and args[0].isdigit() else 20
+        try:
+            output = files.tail(self.log_file, min(lines, MAX_LOG_LINES))
+        except OSError as error:
+            update.message.reply_text(f'Could not read the log file: {error}')
+            return
+
+        if marked:
+            output = '\n'.join(mark_severity(line) for line in output.splitlines())
+        update.message.reply_text(output[-MAX_MESSAGE_LENGTH:] or 'The log file is empty')
+
+    @bot_command(name='tail', description='Follow a file live in one message: /tail <file> [lines], /tail stop')
+    @admin_required
+    def tail(self, bot, update):
+        owner = update.message.from_user.username
+        args = update.message.text.split()[1:]
+        previous = self.tails.pop(owner, None)
+        if previous is not None:
+            self.jobs.cancel(previous.id, owner)
+        if args == ['stop']:
+            update.message.reply_text('Stopped following' if previous else 'Nothing is being followed')
+            return
+
+        if not 1 <= len(args) <= 2 or (len(args) == 2 and not args[1].isdigit()):
+            update.message.reply_text('Usage: /tail <file> [lines] or /tail stop')
+            return
+        path = args[0]
+        lines = deque(maxlen=min(int(args[1]) if len(args) == 2 else 20, MAX_LOG_LINES))
+        try:
+            follower = files.TailFollower(path)
+            lines.extend(files.tail(path, lines.maxlen).splitlines())
+        except OSError as error:
+            update.message.reply_text(f'Could not read {path}: {error}')
+            return
+
+        def render():
+            text = self.redact('\n'.join(lines))
+            return f'📜 {path}\n' + text[-(MAX_MESSAGE_LENGTH - len(path) - 3):]
+
+        message = update.message.reply_text(render())
+        stopped = threading.Event()
+        job = self.jobs.add(owner, 'tail', path, stopped.set)
+        self.tails[owner] = job
+
+        def notify(text):
+            try:
+                self.bot.send_message(chat_id=message.chat_id, text=text)
+            except TelegramError as error:
+                logging.warning('Could not report the end of the tail of %s: %s', path, error)
+
+        def follow():
+            deadline = time.time() + self.tail_duration
+            while not stopped.wait(TAIL_INTERVAL) and time.time() < deadline:
+                try:
+                    new = follower.read_new()
+                except OSError as error:
+                    notify(f'Stopped following {path}: {error}')
+                    break
+                if not new:
+                    continue
+                lines.extend(new.splitlines())
+                try:
+                    self.bot.edit_message_text(render(), chat_id=message.chat_id, message_id=message.message_id)
+                except TelegramError as error:
+                    logging.warning('Could not update the tail of %s: %s', path, error)
+            else:
+                if not stopped.is_set():
+                    notify(f'Stopped following {path} after {self.tail_duration}s')
+            self.jobs.remove(job.id)
+            if self.tails.get(owner) is job:
+                del self.tails[owner]
+
+        threading.Thread(target=follow, daemon=True).start()
+
+    @bot_command(name='alias', description='Manage command aliases: add <name> <command>, list, rm <name>')
+    @admin_required
+    def alias(self, bot, update):
+        args = update.message.text.split(maxsplit=3)[1:]
+        aliases = self.aliases.setdefault(update.message.from_user.username, {})
+
+        if args[:1] == ['add'] and len(args) == 3:
+            aliases[args[1]] = args[2]
+            update.message.reply_text(f'Alias {args[1]} saved')
+        elif args[:1] == ['rm'] and len(args) == 2:
+            removed = aliases.pop(args[1], None)
+            update.message.reply_text(f'Alias {args[1]} removed' if removed else f'No alias named {args[1]}')
+        elif args == ['list']:
+            listing = '\n'.join(f'{name} - {command}' for name, command in sorted(aliases.items()))
+            update.message.reply_text(listing or 'You have no aliases')
+        else:
+            update.message.reply_text('Usage: /alias add <name> <command> | /alias list | /alias rm <name>')
+
+    @bot_command(name='run', description='Execute a saved alias')
+    @admin_required
+    @state_changing
+    def run_alias(self, bot, update):
+        args = update.message.text.split()[1:]
+        aliases = self.aliases.get(update.message.from_user.username, {})
+        if len(args) != 1 or args[0] not in aliases:
+            update.message.reply_text('Usage: /run <alias>, see /alias list')
+            return
+        if self.exec_permitted(update, aliases[args[0]]):
+            self.execute(update, aliases[args[0]])
+
+    @bot_command(name='ip', description='List IPv4 and IPv6 addresses of every interface')
+    @admin_required
+    @viewer_allowed
+    def ip(self, bot, update):
+        try:
+            interfaces = network.interface_addresses()
+        except OSError as error:
+            update.message.reply_text(f'Could not read interface addresses: {error}')
+            return
+
+        lines = []
+        for name, addresses in interfaces.items():
+            lines.append(f'{name}:')
+            lines.extend(
+                '  {family} {address}{scope}'.format(
+                    scope=' (link-local)' if address['link_local'] else '',
+                    **address
+                )
+                for address in addresses
+            )
+        update.message.reply_text('\n'.join(lines) or 'No addresses found')
+
+    @bot_command(name='ports', description='List listening sockets and their processes: /ports [tcp|udp]')
+    @admin_required
+    @viewer_allowed
+    def ports(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) > 1 or args[:1] not in ([], ['tcp'], ['udp']):
+            update.message.reply_text('Usage: /ports [tcp|udp]')
+            return
+
+        listening = network.listening_ports(args or ('tcp', 'udp'))
+        rows = '\n'.join(
+            '{protocol:<5} {address:<22} {pid:>7} {name}'.format(**{**entry, 'pid': entry['pid'] or '-'})
+            for entry in listening
+        )
+        if not listening:
+            update.message.reply_text('Nothing is listening')
+            return
+        if len(rows) > MAX_MESSAGE_LENGTH // 2:
+            # Leaves room for the header and for html.escape growing the text.
+            rows = rows[:MAX_MESSAGE_LENGTH // 2].rsplit('\n', 1)[0] + '\n...'
+        update.message.reply_text(
+            '<pre>{header}\n{rows}</pre>'.format(
+                header=f'{"PROTO":<5} {"ADDRESS":<22} {"PID":>7} PROCESS',
+                rows=html.escape(rows)
+            ),
+            parse_mode=ParseMode.HTML
+        )
+
+    @bot_command(name='jobs', description='List your background jobs, or cancel one with /jobs kill <id>')
+    @admin_required
+    def list_jobs(self, bot, update):
+        owner = update.message.from_user.username
+        args = update.message.text.split()[1:]
+        if args[:1] == ['kill']:
+            if len(args) != 2 or not args[1].isdigit():
+                update.message.reply_text('Usage: /jobs kill <id>')
+                return
+            job = self.jobs.cancel(int(args[1]), owner)
+            update.message.reply_text(f'Cancelled job {job.id}' if job else f'No job with id {args[1]}')
+            return
+
+        listing = '\n'.join(
+            f'{job.id}: [{job.kind}] {job.description} (running {int(time.time() - job.started)}s)'
+            for job in self.jobs.list(owner)
+        )
+        update.message.reply_text(listing or 'No background jobs')
+
+    @bot_command(name='touch', description='Create a file or update its modification time')
+    @admin_required
+    @state_changing
+    def touch(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 1:
+            update.message.reply_text('Usage: /touch <file>')
+            return
+
+        path = os.path.abspath(args[0])
+        try:
+            files.touch(path)
+        except OSError as error:
+            update.message.reply_text(f'Could not touch {path}: {error}')
+            return
+        update.message.reply_text(f'Touched {path}')
+
+    @bot_command(name='append', description='Append a line of text to a file')
+    @admin_required
+    @state_changing
+    def append(self, bot, update):
+        args = update.message.text.split(maxsplit=2)[1:]
+        if len(args) != 2:
+            update.message.reply_text('Usage: /append <file> <text>')
+            return
+
+        path = os.path.abspath(args[0])
+        try:
+            files.append_line(path, args[1])
+        except OSError as error:
+            update.message.reply_text(f'Could not append to {path}: {error}')
+            return
+        update.message.reply_text(f'Appended a line to {path}')
+
+    @bot_command(name='gzip', description='Compress a file: /gzip [-f] <file> [dest]')
+    @admin_required
+    @state_changing
+    def gzip(self, bot, update):
+        args = update.message.text.split()[1:]
+        force = args[:1] == ['-f']
+        args = args[force:]
+        if len(args) not in (1, 2):
+            update.message.reply_text('Usage: /gzip [-f] <file> [dest]')
+            return
+
+        source = os.path.abspath(args[0])
+        destination = os.path.abspath(args[1] if len(args) == 2 else f'{args[0]}.gz')
+        self.convert_file(update, files.compress, source, destination, force)
+
+    @bot_command(name='gunzip', description='Decompress a file: /gunzip [-f] <file> [dest]')
+    @admin_required
+    @state_changing
+    def gunzip(self, bot, update):
+        args = update.message.text.split()[1:]
+        force = args[:1] == ['-f']
+        args = args[force:]
+        if len(args) not in (1, 2) or (len(args) == 1 and not args[0].endswith('.gz')):
+            update.message.reply_text('Usage: /gunzip [-f] <file.gz> [dest]')
+            return
+
+        source = os.path.abspath(args[0])
+        destination = os.path.abspath(args[1] if len(args) == 2 else args[0][:-len('.gz')])
+        self.convert_file(
+            update,
+            lambda source, destination: files.decompress(source, destination, MAX_COMPRESS_SIZE),
+            source, destination, force
+        )
+
+    def convert_file(self, update, convert, source, destination, force):
+        if not os.path.isfile(source):
+            update.message.reply_text(f'{source} is not a file')
+            return
+        if os.path.getsize(source) > MAX_COMPRESS_SIZE:
+            update.message.reply_text(f'{source} is larger than {resources.format_bytes(MAX_COMPRESS_SIZE)}')
+            return
+        if os.path.realpath(source) == os.path.realpath(destination):
+            update.message.reply_text('Source and destination are the same file')
+            return
+        if os.path.exists(destination) and not force:
+            update.message.reply_text(f'{destination} already exists, use -f to overwrite')
+            return
+
+        try:
+            convert(source, destination)
+        except (OSError, EOFError, ValueError) as error:
+            update.message.reply_text(f'Could not write {destination}: {error}')
+            return
+
+        before, after = os.path.getsize(source), os.path.getsize(destination)
+        ratio = after / before * 100 if before else 100
+        update.message.reply_text(
+            f'{source} ({resources.format_bytes(before)}) -> '
+            f'{destination} ({resources.format_bytes(after)}), {ratio:.1f}% of the original size'
+        )
+
+    @bot_command(name='whoami', description='Show your Telegram user and the OS user commands run as')
+    @admin_required
+    @viewer_allowed
+    def whoami(self, bot, update):
+        user = pwd.getpwuid(self.exec_credentials.get('user', os.geteuid()))
+        update.message.reply_text(
+            f'Telegram user: {update.message.from_user.username}\n'
+            f'OS user: {user.pw_name} (uid {user.pw_uid}, gid {user.pw_gid})\n'
+            f'Privileged: {"yes" if user.pw_uid == 0 else "no"}'
+        )
+
+    @bot_command(name='pwd', description='Show the directory commands run in')
+    @admin_required
+    def working_directory(self, bot, update):
+        user = pwd.getpwuid(self.exec_credentials.get('user', os.geteuid())).pw_name
+        sandbox = f', inside {" ".join(self.exec_wrapper)}' if self.exec_wrapper else ''
+        update.message.reply_text(f'{self.exec_dir or os.getcwd()} (as {user}{sandbox})')
+
+    @bot_command(name='reboot', description='Schedule a reboot in <minutes>, with a cancel button')
+    @admin_required
+    @state_changing
+    def reboot(self, bot, update):
+        if not self.power_commands:
+            update.message.reply_text('Power commands are disabled')
+            return
+
+        args = update.message.text.split()[1:]
+        if len(args) != 1 or not args[0].isdigit() or int(args[0]) < 1:
+            update.message.reply_text('Usage: /reboot <minutes>')
+            return
+
+        minutes = int(args[0])
+        try:
+            exit_code, output = shell.run_args(
+                ['shutdown', '-r', f'+{minutes}'], timeout=self.command_timeout('reboot')
+            )
+        except (OSError, subprocess.TimeoutExpired) as error:
+            update.message.reply_text(f'Could not schedule the reboot: {error}')
+            return
+        if exit_code != 0:
+            update.message.reply_text(f'Could not schedule the reboot: {output}')
+            return
+
+        scheduled = time.strftime('%H:%M', time.localtime(time.time() + minutes * 60))
+        logging.warning('Reboot scheduled for %s by %s', scheduled, update.message.from_user.username)
+        keyboard = InlineKeyboardMarkup([[InlineKeyboardButton('❌ Cancel', callback_data='cancel_reboot')]])
+        update.message.reply_text(f'Reboot scheduled at {scheduled}', reply_markup=keyboard)
+
+    def cancel_reboot(self, bot, update):
+        query = update.callback_query
+        query.answer()
+        if query.from_user.username not in self.admins:
+            self.audit_outcome.result = 'blocked: unauthorized user'
+            return
+
+        try:
+            exit_code, output = shell.run_args(['shutdown', '-c'], timeout=self.command_timeout('reboot'))
+        except (OSError, subprocess.TimeoutExpired) as error:
+            exit_code, output = None, str(error)
+        result = 'Reboot cancelled' if exit_code == 0 else f'Could not cancel the reboot: {output}'
+        self.audit_outcome.result = 'cancelled' if exit_code == 0 else f'failed: {output}'
+        logging.warning('%s by %s', result, query.from_user.username)
+        query.edit_message_text(f'{query.message.text}\n\n{result}')
+
+    @bot_command(name='fd', description='Show open file descriptors against the system limit')
+    @admin_required
+    @viewer_allowed
+    def file_descriptors(self, bot, update):
+        allocated, maximum = resources.open_files()
+        percent = 100 * allocated / maximum
+        update.message.reply_text(
+            f'{resources.status_icon(percent)} Open file descriptors: {allocated} / {maximum} ({percent:.2f}%)'
+        )
+
+    @bot_command(name='broadcast', description='Send a message to every admin who has used the bot')
+    @admin_required
+    def broadcast(self, bot, update):
+        text = update.message.text.replace('/broadcast', '', 1).strip()
+        if not text:
+            update.message.reply_text('Usage: /broadcast <message>')
+            return
+
+        sender = update.message.from_user.username
+        delivered = self.send_to_admins(f'📢 {sender}: {text}')
+        update.message.reply_text(f'Broadcast delivered to {delivered} of {len(self.admin_chats)} chats')
+
+    @bot_command(name='countdown', description='Broadcast reminders counting down to maintenance in <minutes>')
+    @admin_required
+    def countdown(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 1 or not args[0].isdigit() or int(args[0]) < 1:
+            update.message.reply_text('Usage: /countdown <minutes>')
+            return
+
+        minutes = int(args[0])
+        start = time.time()
+        stopped = threading.Event()
+        job = self.jobs.add(
+            update.message.from_user.username, 'countdown', f'maintenance in {minutes} minutes', stopped.set
+        )
+
+        def remind():
+            self.send_to_admins(f'🛠 Maintenance starts in {minutes} minutes')
+            for remaining in (reminder for reminder in COUNTDOWN_REMINDERS if reminder < minutes):
+                if stopped.wait(start + (minutes - remaining) * 60 - time.time()):
+                    return
+                self.send_to_admins(f'🛠 Maintenance starts in {remaining} minutes')
+            if not stopped.wait(start + minutes * 60 - time.time()):
+                self.send_to_admins('🛠 Maintenance is starting now')
+            self.jobs.remove(job.id)
+
+        threading.Thread(target=remind, daemon=True).start()
+        update.message.reply_text(f'Countdown started as job {job.id}')
+
+    def send_to_admins(self, text):
+        delivered = 0
+        for username, chat_id in list(self.admin_chats.items()):
+            try:
+                self.send_message(chat_id, text)
+                delivered += 1
+                logging.info('Alert delivered to %s', username)
+            except Unauthorized as error:
+                # The admin blocked the bot or removed it from the chat; stop alerting
+                # them until they talk to the bot again and admin_required re-adds the chat.
+                self.admin_chats.pop(username, None)
+                logging.warning('Admin %s no longer accepts alerts, removing chat %s: %s', username, chat_id, error)
+            except TelegramError as error:
+                logging.warning('Alert not delivered to %s: %s', username, error)
+
+        if self.admin_chats and not delivered:
+            logging.error('Alert not delivered to any admin: %s', text)
+        return delivered
+
+    @bot_command(name='authlog', description='Show recent SSH logins and failed attempts by IP')
+    @admin_required
+    def auth_log(self, bot, update):
+        args = update.message.text.split()[1:]
+        count = int(args[0]) if args and args[0].isdigit() else 200
+        try:
+            events, failures = auth.login_events(min(count, MAX_AUTH_LINES), self.command_timeout('authlog'))
+        except (OSError, subprocess.TimeoutExpired) as error:
+            update.message.reply_text(f'Could not read the authentication log: {error}')
+            return
+
+        summary = '\n'.join(f'{ip}: {attempts}' for ip, attempts in failures.most_common(10))
+        report = '\n'.join(events[-20:]) or 'No login events found'
+        if summary:
+            report += f'\n\nFailed attempts by IP:\n{summary}'
+        update.message.reply_text(report[-MAX_MESSAGE_LENGTH:])
+
+    def alert_login(self, user, ip):
+        if time.time() - self.login_alerts.get(ip, 0) < LOGIN_ALERT_COOLDOWN:
+            with self.alert_lock:
+                self.alert_statistics('login')['suppressed'] += 1
+            return
+        self.login_alerts[ip] = time.time()
+        self.send_alert('login', f'🔑 New SSH login: {user} from {ip}')
+
+    def command_blocked(self, update, reason):
+        self.audit_outcome.result = f'blocked: {reason}'
+        user = update.message.from_user
+        logging.warning('Blocked command from %s (%s, %s): %s', user.username, user.id, reason, update.message.text)
+        if self.alert_on_blocked:
+            self.send_alert(
+                'blocked', f'⛔ Blocked command ({reason}) from {user.username} ({user.id}): {update.message.text}'
+            )
+
+    def audit(self, update, result):
+        if not self.audit_file:
+            return
+        if update.callback_query:
+            command = f'button {update.callback_query.data}'
+            if self.audit_outcome.command:
+                command += f': {self.audit_outcome.command}'
+        else:
+            command = update.message.text
+        user = update.effective_user
+        record = json.dumps({
+            'time': time.strftime('%Y-%m-%dT%H:%M:%SZ', time.gmtime()),
+            'user_id': user.id,
+            'username': user.username,
+            'command': command,
+            'result': result
+        }, ensure_ascii=False)
+        try:
+            with self.audit_lock:
+                files.append_line(self.audit_file, record)
+        except OSError as error:
+            logging.error('Could not write the audit log: %s', error)
+
+    def alert_statistics(self, kind):
+        return self.alert_stats.setdefault(kind, {'last': None, 'suppressed': 0})
+
+    def send_alert(self, kind, text):
+        with self.alert_lock:
+            statistics = self.alert_statistics(kind)
+            now = time.time()
+            while self.alert_times and now - self.alert_times[0] > ALERT_RATE_WINDOW:
+                self.alert_times.popleft()
+            if len(self.alert_times) >= ALERT_RATE_LIMIT:
+                statistics['suppressed'] += 1
+                logging.warning('Alert suppressed by the rate limit: %s', text)
+                return
+
+            self.alert_times.append(now)
+            if statistics['suppressed']:
+                text += f'\n\n({statistics["suppressed"]} {kind} alerts suppressed since the last one)'
+            statistics.update(last=now, suppressed=0)
+        self.send_to_admins(text)
+
+    @bot_command(name='alerts', description='Show when each alert type last fired and how many were suppressed')
+    @admin_required
+    def alerts(self, bot, update):
+        with self.alert_lock:
+            stats = {kind: dict(statistics) for kind, statistics in self.alert_stats.items()}
+
+        lines = []
+        for kind in ('login', 'blocked', 'fd'):
+            statistics = stats.get(kind, {'last': None, 'suppressed': 0})
+            last = statistics['last']
+            last = time.strftime('%Y-%m-%d %H:%M:%S', time.localtime(last)) if last else 'never'
+            lines.append(f'{kind}: last sent {last}, {statistics["suppressed"]} suppressed since')
+        update.message.reply_text('\n'.join(lines))
+
+    def watch_logins(self):
+        try:
+            auth.watch_logins(self.alert_login)
+        except OSError as error:
+            logging.error('SSH login alerts stopped: %s', error)
+
+    def watch_file_descriptors(self):
+        # Alerts once when usage crosses the threshold and again only after it has dropped below.
+        alerted = False
+        while True:
+            try:
+                allocated, maximum = resources.open_files()
+            except OSError as error:
+                logging.error('File descriptor alerts stopped: %s', error)
+                return
+            percent = 100 * allocated / maximum
+            if percent >= self.fd_alert_percent and not alerted:
+                self.send_alert('fd', f'📂 Open file descriptors at {allocated} / {maximum} ({percent:.2f}%)')
+            alerted = percent >= self.fd_alert_percent
+            time.sleep(FD_ALERT_INTERVAL)
+
+    @bot_command(name='df', description='Show usage of every mounted filesystem, -a to include tmpfs and the like')
+    @admin_required
+    @viewer_allowed
+    def df(self, bot, update):
+        args = update.message.text.split()[1:]
+        if args not in ([], ['-a']):
+            update.message.reply_text('Usage: /df [-a]')
+            return
+
+        rows = '\n'.join(
+            '{device:<20} {mountpoint:<16} {fstype:<8} {total:>9} {used:>9} {free:>9} {percent:>3.0f}%'.format(
+                **{
+                    **usage,
+                    'total': resources.format_bytes(usage['total']),
+                    'used': resources.format_bytes(usage['used']),
+                    'free': resources.format_bytes(usage['free'])
+                }
+            )
+            for usage in mounts.disk_usage(include_pseudo=args == ['-a'])
+        )
+        if len(rows) > MAX_MESSAGE_LENGTH // 2:
+            rows = rows[:MAX_MESSAGE_LENGTH // 2].rsplit('\n', 1)[0] + '\n...'
+        update.message.reply_text(
+            '<pre>{header}\n{rows}</pre>'.format(
+                header=f'{"DEVICE":<20} {"MOUNTED ON":<16} {"TYPE":<8} {"SIZE":>9} {"USED":>9} {"FREE":>9} USE%',
+                rows=html.escape(rows)
+            ),
+            parse_mode=ParseMode.HTML
+        )
+
+    @bot_command(name='dusage', description='Show how much space deleting a file or directory would free')
+    @admin_required
+    def disk_usage(self, bot, update):
+        args = update.message.text.split()[1:]
+        if len(args) != 1:
+            update.message.reply_text('Usage: /dusage <path>')
+            return
+
+        path = os.path.abspath(args[0])
+        try:
+            size, complete = files.total_size(path, MAX_WALK_ENTRIES)
+            free = shutil.disk_usage(path).free
+        except OSError as error:
+            update.message.reply_text(f'Could not measure {path}: {error}')
+            return
+
+        estimate = '' if complete else f' (at least, stopped after {MAX_WALK_ENTRIES} entries)'
+        update.message.reply_text(
+            f'{path}: {resources.format_bytes(size)}{estimate}\n'
+            f'Free now: {resources.format_bytes(free)}\n'
+            f'Free after deletion: {resources.format_bytes(free + size)}'
+        )
+
+    @bot_command(name='benchmark', description='Run a quick, rough CPU and disk benchmark')
+    @admin_required
+    def run_benchmark(self, bot, update):
+        directory = tempfile.gettempdir()
+        if not os.access(directory, os.W_OK):
+            update.message.reply_text(f'{directory} is not writable')
+            return
+
+        update.message.reply_text('Running the benchmark, this takes a few seconds...')
+        hashes = benchmark.cpu_hashes_per_second()
+        try:
+            write, read = benchmark.disk_throughput(directory)
+        except OSError as error:
+            update.message.reply_text(f'Disk benchmark failed: {error}')
+            return
+
+        update.message.reply_text(
+            'Rough indicator only, not a real benchmark:\n'
+            f'CPU: {hashes:,.0f} SHA-256 hashes/s (single core)\n'
+            f'Disk write: {write:.0f} MB/s\n'
+            f'Disk read: {read:.0f} MB/s (likely cached)'
+        )
+
+    @bot_command(name='logout', description='End your session: forget aliases, jobs and alerts for you')
+    @admin_required
+    def logout(self, bot, update):
+        username = update.message.from_user.username
+        self.aliases.pop(username, None)
+        self.admin_chats.pop(username, None)
+        self.discard_confirmation(update.message.from_user.id)
+        cancelled = [job.id for job in self.jobs.list(username) if self.jobs.cancel(job.id, username)]
+
+        update.message.reply_text(
+            f'Session ended, cancelled {len(cancelled)} jobs. Send any command to start again.',
+            reply_markup=ReplyKeyboardRemove()
+        )
+
+    @bot_command(name='restart', description='Restart the bot process')
+    @admin_required
+    @state_changing
+    def restart(self, bot, update):
+        if not self.allow_restart:
+            update.message.reply_text('Restarting the bot is disabled')
+            return
+        self.require_confirmation(update, 'Restart the bot?', self.restart_process)
+
+    def restart_process(self, message):
+        message.reply_text('Restarting...')
+        logging.warning('Restarting the bot')
+
+        def stop_and_exec():
+            self.stop()
+            os.environ[RESTART_CHAT_VARIABLE] = str(message.chat_id)
+            os.execv(sys.executable, sys.orig_argv)
+
+        # The updater can't be stopped from one of its own worker threads.
+        threading.Thread(target=stop_and_exec).start()
+
+    @bot_command(name='dashboard', description='Show status, top processes and disk usage at a glance')
+    @admin_required
+    @viewer_allowed
+    def dashboard(self, bot, update):
+        update.message.reply_text(self.dashboard_text(), reply_markup=DASHBOARD_KEYBOARD)
+
+    def refresh_dashboard(self, bot, update):
+        query = update.callback_query
+        query.answer()
+        if query.from_user.username not in self.admins + self.viewers:
+            self.audit_outcome.result = 'blocked: unauthorized user'
+            return
+        query.edit_message_text(self.dashboard_text(), reply_markup=DASHBOARD_KEYBOARD)
+
+    def dashboard_text(self):
+        top = '\n'.join(
+            '  {pid} {name} {cpu:.1f}% CPU'.format(**info) for info in process.top_processes('cpu', 3)
+        )
+        disks = '\n'.join(
+            '  {icon} {mountpoint} {percent:.0f}% of {total}'.format(
+                icon=resources.status_icon(usage['percent']),
+                mountpoint=usage['mountpoint'],
+                percent=usage['percent'],
+                total=resources.format_bytes(usage['total'])
+            )
+            for usage in mounts.disk_usage()
+        )
+        text = (
+            f'{resources.summary(self.monitored_mounts)}\n'
+            f'Uptime: {resources.uptime()}\n\n'
+            f'Top processes:\n{top}\n\n'
+            f'Disks:\n{disks}'
+        )
+        if len(text) > MAX_MESSAGE_LENGTH:
+            text = text[:MAX_MESSAGE_LENGTH - 1] + '…'
+        return text
+
+    @bot_command(name='dns', description='Resolve a hostname: /dns <hostname> [A|AAAA|CNAME]')
+    @admin_required
+    @viewer_allowed
+    def dns(self, bot, update):
+        args = update.message.text.split()[1:]
+        record_type = args[1].upper() if len(args) == 2 else 'A'
+        if len(args) not in (1, 2) or not network.valid_hostname(args[0]):
+            update.message.reply_text('Usage: /dns <hostname> [A|AAAA|CNAME]')
+            return
+        if record_type not in (*network.RECORD_FAMILIES, 'CNAME'):
+            update.message.reply_text('Only A, AAAA and CNAME lookups are supported')
+            return
+
+        try:
+            records = network.resolve(args[0], record_type)
+        except OSError as error:
+            records = [f'lookup failed: {error}']
+        resolvers = ', '.join(network.nameservers()) or 'unknown'
+        update.message.reply_text(
+            f'{args[0]} {record_type}:\n' + ('\n'.join(records) or 'no records') + f'\n\nResolvers: {resolvers}'
+        )
+
+    @bot_command(name='version', description='Show which build of the bot is running')
+    @admin_required
+    @viewer_allowed
+    def version(self, bot, update):
+        source = os.path.dirname(os.path.abspath(__file__))
+        try:
+            exit_code, commit = shell.run_args(['git', '-C', source, 'log', '-1', '--format=%h %ci'], timeout=5)
+        except (OSError, subprocess.TimeoutExpired):
+            exit_code = 1
+        uptime = int(time.time() - self.started)
+        update.message.reply_text(
+            f'Commit: {commit.strip() if exit_code == 0 else "unknown"}\n'
+            f'Python: {platform.python_version()}\n'
+            f'python-telegram-bot: {telegram.__version__}\n'
+            f'Platform: {platform.system()} {platform.machine()}\n'
+            f'Bot uptime: {uptime // 3600}h {uptime % 3600 // 60}m'
+        )
+
+    @bot_command(name='memdetail', description='Show a detailed memory breakdown')
+    @admin_required
+    @viewer_allowed
+    def memory_detail(self, bot, update):
+        info = resources.meminfo()
+        total = info['MemTotal']
+        info[None] = total - info.get('MemAvailable', info['MemFree'])
+
+        rows = [f'{"Total":<15} {resources.format_bytes(total):>10}']
+        rows.extend(
+            f'{label:<15} {resources.format_bytes(info[field]):>10} {resources.bar(100 * info[field] / total)}'
+            for label, field in MEMORY_FIELDS if field in info
+        )
+        if info.get('SwapTotal'):
+            swap_used = info['SwapTotal'] - info['SwapFree']
+            rows.append(
+                f'{"Swap used":<15} {resources.format_bytes(swap_used):>10} '
+                f'{resources.bar(100 * swap_used / info["SwapTotal"])}'
+            )
+        update.message.reply_text('<pre>{}</pre>'.format(html.escape('\n'.join(rows))), parse_mode=ParseMode.HTML)
+
+    @bot_command(name='os', description='Show kernel and OS release details')
+    @admin_required
+    @viewer_allowed
+    def os_release(self, bot, update):
+        try:
+            release = platform.freedesktop_os_release()
+        except OSError:
+            release = {}
+        uname = platform.uname()
+        update.message.reply_text(
+            f'OS: {release.get("PRETTY_NAME", uname.system)}\n'
+            f'Kernel: {uname.system} {uname.release}\n'
+            f'Build: {uname.version}\n'
+            f'Architecture: {uname.machine}\n'
+            f'Hostname: {uname.node}'
+        )
+
+    @bot_command(name='configinfo', description='Show where the config was loaded from')
+    @admin_required
+    def config_info(self, bot, update):
+        path = os.path.abspath(config.__file__)
+        modified = time.strftime('%Y-%m-%d %H:%M:%S', time.localtime(os.path.getmtime(path)))
+        overrides = sorted(name for name in ENV_OPTIONS if name in os.environ)
+        update.message.reply_text(
+            f'Config file: {path}\n'
+            f'Last modified: {modified}\n'
+            f'Overridden by the environment: {", ".join(overrides) or "none"}'
+        )
+
+    @bot_command(name='reload', description='Reload the configuration')
+    @admin_required
+    def reload(self, bot, update):
+        try:
+            changed, restart = self.reload_config()
+        except Exception as error:
+            update.message.reply_text(f'Config not reloaded, keeping the current one: {error}')
+            return
+
+        update.message.reply_text(
+            'Config reloaded.\nApplied: {applied}\nRequires restart: {restart}'.format(
+                applied=', '.join(changed) or 'none',
+                restart=', '.join(restart) or 'none'
+            )
+        )
+
+    def reload_config(self):
+        importlib.reload(config)
+        options = bot_options(self.shard)
+
+        # The admins property also holds the admins file entries, which are not part of the config.
+        current = {name: getattr(self, name) for name in LIVE_OPTIONS}
+        current['admins'] = self.configured_admins
+        changed = [name for name in LIVE_OPTIONS if options[name] != current[name]]
+        for name in changed:
+            setattr(self, name, options[name])
+
+        restart = [
+            name for name in options.keys() | self.startup_options.keys()
+            if name not in LIVE_OPTIONS and options.get(name) != self.startup_options.get(name)
+        ]
+        logging.info('Config reloaded, applied: %s, requires restart: %s', changed, restart)
+        return changed, sorted(restart)
+
+    def launch(self):
+        if self.admins_file:
+            threading.Thread(target=self.watch_admins_file, daemon=True).start()
+        if self.alert_on_login:
+            threading.Thread(target=self.watch_logins, daemon=True).start()
+        if self.fd_alert_percent:
+            threading.Thread(target=self.watch_file_descriptors, daemon=True).start()
+
+        restart_chat = os.environ.pop(RESTART_CHAT_VARIABLE, None) if self.shard is None else None
+        if restart_chat:
+            try:
+                self.send_message(int(restart_chat), 'Bot restarted')
+            except TelegramError as error:
+                logging.warning('Could not announce the restart: %s', error)
+
+        if not self.webhook_url:
+            self.start_polling()
+            return
+        # The token in the path keeps strangers who find the port from posting updates.
+        self.start_webhook(
+            listen=self.webhook_listen,
+            port=self.webhook_port,
+            url_path=self.bot.token,
+            webhook_url=f'{self.webhook_url}/{self.bot.token}'
+        )
+        logging.info('Receiving updates through the webhook on %s:%s', self.webhook_listen, self.webhook_port)
+
+    def run(self):
+        self.launch()
+        self.idle()
+
+
+def bot_options(shard=None):
+    options = {
+        'token': os.environ.get('API_TOKEN_KEY', config.API_TOKEN_KEY),
+        'admins': username_list(os.environ['ADMINS']) if 'ADMINS' in os.environ else config.ADMINS,
+        'viewers': username_list(os.environ['VIEWERS']) if 'VIEWERS' in os.environ else config.VIEWERS,
+        'admins_file': os.environ.get('ADMINS_FILE', config.ADMINS_FILE),
+        'read_only': os.environ.get('READ_ONLY', str(config.READ_ONLY)).lower() == 'true',
+        'mount_devices': config.MOUNT_DEVICES,
+        'mount_points': config.MOUNT_POINTS,
+        'log_file': os.environ.get('LOG_FILE', config.LOG_FILE),
+        'start_status': os.environ.get('START_STATUS', str(config.START_STATUS)).lower() == 'true',
+        'exec_user': os.environ.get('EXEC_USER', config.EXEC_USER),
+        'exec_dir': os.environ.get('EXEC_DIR', config.EXEC_DIR),
+        'exec_wrapper': config.EXEC_WRAPPER,
+        'power_commands': os.environ.get('POWER_COMMANDS', str(config.POWER_COMMANDS)).lower() == 'true',
+        'unauthorized_message': os.environ.get('UNAUTHORIZED_MESSAGE', config.UNAUTHORIZED_MESSAGE),
+        'silent_unauthorized': os.environ.get(
+            'SILENT_UNAUTHORIZED', str(config.SILENT_UNAUTHORIZED)
+        ).lower() == 'true',
+        'alert_on_login': os.environ.get('ALERT_ON_LOGIN', str(config.ALERT_ON_LOGIN)).lower() == 'true',
+        'command_timeouts': config.COMMAND_TIMEOUTS,
+        'persistent_keyboard': os.environ.get(
+            'PERSISTENT_KEYBOARD', str(config.PERSISTENT_KEYBOARD)
+        ).lower() == 'true',
+        'redact_values': config.REDACT_VALUES,
+        'allow_restart': os.environ.get('ALLOW_RESTART', str(config.ALLOW_RESTART)).lower() == 'true',
+        'command_cooldowns': config.COMMAND_COOLDOWNS,
+        'alert_on_blocked': os.environ.get('ALERT_ON_BLOCKED', str(config.ALERT_ON_BLOCKED)).lower() == 'true',
+        'duplicate_window': float(os.environ.get('DUPLICATE_WINDOW', config.DUPLICATE_WINDOW)),
+        'monitored_mounts': config.MONITORED_MOUNTS,
+        'tail_duration': int(os.environ.get('TAIL_DURATION', config.TAIL_DURATION)),
+        'kill_grace_period': float(os.environ.get('KILL_GRACE_PERIOD', config.KILL_GRACE_PERIOD)),
+        'audit_file': os.environ.get('AUDIT_FILE', config.AUDIT_FILE),
+        'allowed_commands': config.ALLOWED_COMMANDS,
+        'webhook_url': os.environ.get('WEBHOOK_URL', config.WEBHOOK_URL),
+        'webhook_listen': os.environ.get('WEBHOOK_LISTEN', config.WEBHOOK_LISTEN),
+        'webhook_port': int(os.environ.get('WEBHOOK_PORT', config.WEBHOOK_PORT)),
+        'fd_alert_percent': float(os.environ.get('FD_ALERT_PERCENT', config.FD_ALERT_PERCENT)),
+        **api_endpoint_options(os.environ.get('API_ENDPOINT', config.API_ENDPOINT))
+    }
+    if shard is not None:
+        if shard >= len(config.EXTRA_BOTS):
+            raise ValueError(f'Extra bot {shard} was removed from the config, restart to apply')
+        options.update(config.EXTRA_BOTS[shard], shard=shard)
+    return options
+
+
+def bot_tokens():
+    return [
+        os.environ.get('API_TOKEN_KEY', config.API_TOKEN_KEY),
+        *(extra_bot.get('token') for extra_bot in config.EXTRA_BOTS)
+    ]
+
+
+def username_list(value):
+    return [username.strip() for username in value.split(',') if username.strip()]
+
+
+def api_endpoint_options(endpoint):
+    if not endpoint:
+        return {}
+
+    url = urlparse(endpoint)
+    if url.scheme not in ('http', 'https') or not url.netloc:
+        raise ValueError(f'Invalid Telegram API endpoint: {endpoint}')
+
+    endpoint = endpoint.rstrip('/')
+    return {
+        'base_url': f'{endpoint}/bot',
+        'base_file_url': f'{endpoint}/file/bot'
+    }
 
 
 if __name__ == '__main__':
-    app = Bot(
-        token=os.environ.get('API_TOKEN_KEY', config.API_TOKEN_KEY),
-        admins=os.environ.get('ADMINS', config.ADMINS)
+    options = bot_options()
+    logging.basicConfig(
+        filename=options['log_file'] or None,
+        format='%(asctime)s %(levelname)s %(name)s: %(message)s',
+        level=logging.INFO
+    )
+
+    logging.info(
+        'Startup diagnostics: %s',
+        ' '.join(f'{name}={value}' for name, value in diagnostics.collect().items())
     )
+
+    extra_bots = [Bot(**bot_options(shard)) for shard in range(len(config.EXTRA_BOTS))]
+    for extra_bot in extra_bots:
+        extra_bot.launch()
+
+    app = Bot(**options)
+
+    def reload_on_hangup(signum, frame):
+        for reloaded_bot in [app, *extra_bots]:
+            try:
+                reloaded_bot.reload_config()
+            except Exception as error:
+                logging.error('Config not reloaded on SIGHUP, keeping the current one: %s', error)
+
+    signal.signal(signal.SIGHUP, reload_on_hangup)
+    metrics_port = int(os.environ.get('METRICS_PORT', config.METRICS_PORT))
+    if metrics_port:
+        metrics.serve(os.environ.get('METRICS_HOST', config.METRICS_HOST), metrics_port, options['monitored_mounts'])
     app.run()
+
+    for extra_bot in extra_bots:
+        extra_bot.stop()
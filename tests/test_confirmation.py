@@ -0,0 +1,56 @@
+import unittest
+from unittest import mock
+
+from src.lib import telegram
+from src.lib.telegram import CONFIRMATION_TIMEOUT, TelegramBot
+
+
+def command_update(user_id=1):
+    update = mock.MagicMock()
+    update.effective_user.id = user_id
+    return update
+
+
+def button_update(data, user_id=1):
+    update = mock.MagicMock()
+    update.callback_query.data = data
+    update.callback_query.from_user.id = user_id
+    update.callback_query.message.text = 'Kill PID 42?'
+    return update
+
+
+class ConfirmationTest(unittest.TestCase):
+    def setUp(self):
+        self.bot = TelegramBot(token='123456:TEST')
+        self.action = mock.Mock()
+        update = command_update()
+        self.bot.require_confirmation(update, 'Kill PID 42?', self.action)
+        keyboard = update.effective_message.reply_text.call_args[1]['reply_markup']
+        self.confirm = keyboard.inline_keyboard[0][0].callback_data
+
+    def press(self, data):
+        self.bot._TelegramBot__handle_confirmation(None, button_update(data))
+
+    def test_confirm_runs_the_action(self):
+        self.press(self.confirm)
+        self.action.assert_called_once()
+
+    def test_confirm_after_the_timeout_is_rejected(self):
+        expired = telegram.time.time() + CONFIRMATION_TIMEOUT + 1
+        with mock.patch.object(telegram.time, 'time', return_value=expired):
+            self.press(self.confirm)
+        self.action.assert_not_called()
+
+    def test_second_confirm_with_the_same_token_does_nothing(self):
+        self.press(self.confirm)
+        self.press(self.confirm)
+        self.action.assert_called_once()
+
+    def test_cancel_discards_the_action(self):
+        self.press(self.confirm.replace('confirm:', 'cancel:'))
+        self.press(self.confirm)
+        self.action.assert_not_called()
+
+
+if __name__ == '__main__':
+    unittest.main()
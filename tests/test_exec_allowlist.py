@@ -0,0 +1,37 @@
+import unittest
+from unittest import mock
+
+from src.main import Bot
+
+
+def exec_update(text):
+    update = mock.MagicMock()
+    update.message.text = text
+    return update
+
+
+class ExecAllowlistTest(unittest.TestCase):
+    def permitted(self, allowed_commands, command):
+        bot = Bot(token='123456:TEST', admins=['admin'], allowed_commands=allowed_commands)
+        return bot.exec_permitted(exec_update(f'/exec {command}'), command)
+
+    def test_without_an_allowlist_every_command_passes(self):
+        self.assertTrue(self.permitted([], 'rm -rf /tmp/cache; reboot'))
+
+    def test_first_word_matches_a_single_word_entry(self):
+        self.assertTrue(self.permitted(['df'], 'df -h'))
+        self.assertFalse(self.permitted(['df'], 'dfx'))
+
+    def test_multi_word_entries_match_as_a_prefix(self):
+        self.assertTrue(self.permitted(['systemctl status'], 'systemctl status nginx'))
+        self.assertFalse(self.permitted(['systemctl status'], 'systemctl stop nginx'))
+        self.assertFalse(self.permitted(['systemctl status'], 'systemctl'))
+
+    def test_shell_chaining_is_rejected(self):
+        for command in ('df; reboot', 'df | sh', 'df $(reboot)', 'df `reboot`', 'df && reboot'):
+            with self.subTest(command=command):
+                self.assertFalse(self.permitted(['df'], command))
+
+
+if __name__ == '__main__':
+    unittest.main()
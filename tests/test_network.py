@@ -0,0 +1,26 @@
+import time
+import unittest
+
+from src.lib.system import network
+
+
+class HostnameTest(unittest.TestCase):
+    def test_valid_hostnames(self):
+        for name in ('localhost', 'example.com', 'example.com.', '_dmarc.example.com', 'a-b.c0'):
+            with self.subTest(name=name):
+                self.assertTrue(network.valid_hostname(name))
+
+    def test_invalid_hostnames(self):
+        for name in ('', '-a.com', 'a-.com', 'a..com', 'a b.com', 'a' * 64 + '.com', 'a.' * 127 + 'ab'):
+            with self.subTest(name=name):
+                self.assertFalse(network.valid_hostname(name))
+
+    def test_long_non_matching_input_is_rejected_quickly(self):
+        started = time.time()
+        self.assertFalse(network.valid_hostname('a' * 200 + '!'))
+        self.assertFalse(network.valid_hostname('a.' * 120 + '!'))
+        self.assertLess(time.time() - started, 0.1)
+
+
+if __name__ == '__main__':
+    unittest.main()